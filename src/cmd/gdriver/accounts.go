@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gdrive"
+)
+
+func accounts(store *gdrive.TokenStore, remove string) error {
+	if remove != "" {
+		if err := store.Remove(remove); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s\n", remove)
+		return nil
+	}
+
+	list, err := store.Accounts()
+	if err != nil {
+		return err
+	}
+	for _, a := range list {
+		fmt.Println(a)
+	}
+	return nil
+}
+
+func runAccounts(fs *flag.FlagSet, args []string) error {
+	remove := fs.String("remove", "", "remove the stored token of `email`")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	return accounts(gdrive.NewTokenStore(tokenDir), *remove)
+}
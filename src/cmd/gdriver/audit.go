@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cheggaaa/pb"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// auditRow is one permission of one file.
+type auditRow struct {
+	Path     string `json:"path"`
+	FileID   string `json:"fileId"`
+	Grantee  string `json:"grantee"`
+	Type     string `json:"type"`
+	Role     string `json:"role"`
+	WithLink bool   `json:"withLink"`
+
+	// External is set for grantees outside the internal domains,
+	// AnyoneLink for permissions of anyone and OutsiderWriter for
+	// external grantees who can change the file.
+	External       bool `json:"external"`
+	AnyoneLink     bool `json:"anyone"`
+	OutsiderWriter bool `json:"outsiderWriter"`
+}
+
+func (r *auditRow) flagged() bool {
+	return r.External || r.AnyoneLink || r.OutsiderWriter
+}
+
+// paths computes full paths of files from their parents. Parents which
+// are not among the listed files are fetched once.
+type paths struct {
+	srv   *drive.Service
+	files map[string]*drive.File
+	cache map[string]string
+}
+
+func newPaths(srv *drive.Service, files []*drive.File) *paths {
+	p := &paths{srv: srv, files: map[string]*drive.File{}, cache: map[string]string{}}
+	for _, f := range files {
+		p.files[f.Id] = f
+	}
+	return p
+}
+
+// path returns the path of the file from My Drive, e.g. /Projects/a.txt.
+// Files shared to the account from elsewhere start with the topmost
+// folder it can see.
+func (p *paths) path(f *drive.File) string {
+	if path, ok := p.cache[f.Id]; ok {
+		return path
+	}
+
+	// Guard against cycles while the path is computed
+	p.cache[f.Id] = "/" + f.Title
+
+	path := "/" + f.Title
+	if len(f.Parents) > 0 && !f.Parents[0].IsRoot {
+		if parent := p.file(f.Parents[0].Id); parent != nil {
+			path = p.path(parent) + path
+		}
+	}
+	p.cache[f.Id] = path
+	return path
+}
+
+func (p *paths) file(id string) *drive.File {
+	if f, ok := p.files[id]; ok {
+		return f
+	}
+	var f *drive.File
+	err := retry(func() (err error) {
+		f, err = p.srv.Files.Get(id).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		debugf("Parent %s: %v\n", id, err)
+	}
+	p.files[id] = f
+	return f
+}
+
+// domainOf returns the domain of an email address.
+func domainOf(email string) string {
+	return strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+}
+
+// auditPermission describes the permission and flags it.
+func auditPermission(path string, f *drive.File, p *drive.Permission, internal map[string]bool) *auditRow {
+	r := &auditRow{
+		Path:     path,
+		FileID:   f.Id,
+		Grantee:  permissionValue(p),
+		Type:     p.Type,
+		Role:     roleName(p),
+		WithLink: p.WithLink,
+	}
+	switch p.Type {
+	case "anyone":
+		r.Grantee = "anyone"
+		r.AnyoneLink = true
+	case "domain":
+		r.External = !internal[strings.ToLower(p.Domain)]
+	default:
+		r.External = r.Grantee != "" && !internal[domainOf(r.Grantee)]
+	}
+	r.OutsiderWriter = (r.External || r.AnyoneLink) && roleRank(p) >= roleRank(&drive.Permission{Role: "writer"})
+	return r
+}
+
+// audit returns the permissions of the files owned by owner. Files whose
+// permissions can't be read are listed on stderr and left out of the
+// rows, which are returned with a partialError.
+func audit(srv *drive.Service, owner string, internal map[string]bool) ([]*auditRow, error) {
+	files, err := findAllFilesFrom(srv, owner)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "Found: %d files or directories\n", len(files))
+
+	// Progress bar
+	bar := pb.New(len(files))
+	bar.Output = os.Stderr
+	bar.SetRefreshRate(time.Second)
+	bar.Start()
+
+	ps := newPaths(srv, files)
+	var rows []*auditRow
+	errs := make([]error, len(files))
+	for i, f := range files {
+		if interrupted() {
+			break
+		}
+		bar.Increment()
+		perms, err := filePermissions(srv, f)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		path := ps.path(f)
+		for _, p := range perms {
+			rows = append(rows, auditPermission(path, f, p, internal))
+		}
+	}
+	bar.Finish()
+
+	failed := 0
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if failed == 0 {
+			fmt.Fprintf(os.Stderr, "Failed:\n")
+		}
+		fmt.Fprintf(os.Stderr, "  %s (%s): %v\n", ps.path(files[i]), files[i].Id, err)
+		failed++
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Path < rows[j].Path })
+	if failed > 0 {
+		return rows, &partialError{Failed: failed, Total: len(files)}
+	}
+	return rows, nil
+}
+
+func writeAuditCSV(w io.Writer, rows []*auditRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Path", "Id", "Grantee", "Type", "Role", "WithLink", "External", "Anyone", "OutsiderWriter"})
+	for _, r := range rows {
+		cw.Write([]string{r.Path, r.FileID, r.Grantee, r.Type, r.Role,
+			strconv.FormatBool(r.WithLink), strconv.FormatBool(r.External),
+			strconv.FormatBool(r.AnyoneLink), strconv.FormatBool(r.OutsiderWriter)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeAuditJSON(w io.Writer, rows []*auditRow) error {
+	if rows == nil {
+		rows = []*auditRow{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rows)
+}
+
+var auditHTML = template.Must(template.New("audit").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Permissions of {{.Owner}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; }
+tr.flagged { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>Permissions of {{.Owner}}</h1>
+<p>{{len .Rows}} permissions, {{.Flagged}} flagged.</p>
+<table>
+<tr><th>Path</th><th>Grantee</th><th>Type</th><th>Role</th><th>With link</th><th>Flags</th></tr>
+{{range .Rows}}<tr{{if .Flagged}} class="flagged"{{end}}>
+<td><a href="https://drive.google.com/open?id={{.FileID}}">{{.Path}}</a></td>
+<td>{{.Grantee}}</td><td>{{.Type}}</td><td>{{.Role}}</td><td>{{if .WithLink}}yes{{end}}</td>
+<td>{{if .External}}external {{end}}{{if .AnyoneLink}}anyone {{end}}{{if .OutsiderWriter}}outsider-writer{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func writeAuditHTML(w io.Writer, owner string, rows []*auditRow) error {
+	type row struct {
+		*auditRow
+		Flagged bool
+	}
+	data := struct {
+		Owner   string
+		Rows    []row
+		Flagged int
+	}{Owner: owner}
+	for _, r := range rows {
+		data.Rows = append(data.Rows, row{r, r.flagged()})
+		if r.flagged() {
+			data.Flagged++
+		}
+	}
+	return auditHTML.Execute(w, data)
+}
+
+func runAudit(fs *flag.FlagSet, args []string) error {
+	format := fs.String("format", "csv", "output `format`: csv, json or html")
+	output := fs.String("output", "", "write the report to `file` instead of standard output")
+	flaggedOnly := fs.Bool("flagged", false, "only report flagged permissions")
+	var domains stringList
+	fs.Var(&domains, "domain", "internal `domain` (repeatable, default the domain of the account)")
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	owner := args[0]
+	switch *format {
+	case "csv", "json", "html":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format %q\n\n", *format)
+		fs.Usage()
+		return errUsage
+	}
+
+	if len(domains) == 0 {
+		domains = append(domains, domainOf(owner))
+	}
+	internal := map[string]bool{}
+	for _, d := range domains {
+		internal[strings.ToLower(d)] = true
+	}
+
+	srv, err := newService()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Auditing files owned by %s", owner)
+
+	// A partial audit is still written
+	rows, partial := audit(srv, owner, internal)
+	if _, ok := partial.(*partialError); partial != nil && !ok {
+		return partial
+	}
+	if *flaggedOnly {
+		var flagged []*auditRow
+		for _, r := range rows {
+			if r.flagged() {
+				flagged = append(flagged, r)
+			}
+		}
+		rows = flagged
+	}
+
+	if *output == "" {
+		if err := writeAudit(os.Stdout, *format, owner, rows); err != nil {
+			return err
+		}
+		return partial
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := writeAudit(f, *format, owner, rows); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return partial
+}
+
+func writeAudit(w io.Writer, format, owner string, rows []*auditRow) error {
+	switch format {
+	case "json":
+		return writeAuditJSON(w, rows)
+	case "html":
+		return writeAuditHTML(w, owner, rows)
+	}
+	return writeAuditCSV(w, rows)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"gdrive/fakedrive"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/drive/v2"
+)
+
+func TestAudit(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	files := s.Files(userA)
+	readme := byTitle(files, "readme.txt")[0]
+	spec := byTitle(files, "spec.txt")[0]
+	s.Update(readme.Id, func(f *drive.File) {
+		f.Permissions = append(f.Permissions, &drive.Permission{Id: "anyoneWithLink", Type: "anyone", Role: "reader", WithLink: true})
+	})
+	s.Share(spec.Id, "mallory@other.com", "writer")
+
+	if code := gdriver(s, userA, "audit", "--format", "json", "--output", "audit.json", userA); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	b, err := ioutil.ReadFile("audit.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []*auditRow
+	if err := json.Unmarshal(b, &rows); err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]*auditRow{}
+	for _, r := range rows {
+		found[r.Path+" "+r.Grantee] = r
+	}
+	for key, want := range map[string]auditRow{
+		"/Projects/readme.txt anyone":               {Role: "reader", WithLink: true, AnyoneLink: true},
+		"/Projects/ACME/spec.txt mallory@other.com": {Role: "writer", External: true, OutsiderWriter: true},
+		"/Projects/ACME/spec.txt " + userB:          {Role: "reader"},
+		"/Projects/ACME/Docs " + userA:              {Role: "owner"},
+	} {
+		r := found[key]
+		if r == nil {
+			t.Errorf("%s not reported", key)
+			continue
+		}
+		if r.Role != want.Role || r.WithLink != want.WithLink || r.External != want.External ||
+			r.AnyoneLink != want.AnyoneLink || r.OutsiderWriter != want.OutsiderWriter {
+			t.Errorf("%s: %+v, want %+v", key, r, want)
+		}
+	}
+
+	if code := gdriver(s, userA, "audit", "--format", "html", "--flagged", "--output", "audit.html", userA); code != exitOK {
+		t.Fatalf("html: exit code %d", code)
+	}
+	b, err = ioutil.ReadFile("audit.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html := string(b); !strings.Contains(html, "2 permissions, 2 flagged") || !strings.Contains(html, "outsider-writer") {
+		t.Errorf("unexpected HTML report:\n%s", html)
+	}
+}
+
+func TestAuditFailure(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	s.OmitListPermissions = true
+	s.AddFault(fakedrive.Fault{Op: "drive.permissions.list", Code: 404, Reason: "notFound", Times: 1})
+
+	if code := gdriver(s, userA, "audit", "--format", "json", "--output", "audit.json", userA); code != exitPartial {
+		t.Fatalf("exit code %d, want %d", code, exitPartial)
+	}
+	b, err := ioutil.ReadFile("audit.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []*auditRow
+	if err := json.Unmarshal(b, &rows); err != nil {
+		t.Fatal(err)
+	}
+	reported := map[string]bool{}
+	for _, r := range rows {
+		reported[r.FileID] = true
+	}
+	if n, want := len(reported), len(s.Files(userA))-1; n != want {
+		t.Errorf("%d files reported, want %d", n, want)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cheggaaa/pb"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// Kinds of check failures
+const (
+	checkFetch    = "fetch"
+	checkName     = "name"
+	checkChecksum = "checksum"
+	checkSize     = "size"
+)
+
+// checkError is a copy which doesn't match its source.
+type checkError struct {
+	Kind string
+	Msg  string
+}
+
+func (e *checkError) Error() string {
+	return e.Msg
+}
+
+// checkItem compares the copy with the source recorded in the plan.
+func checkItem(srv *drive.Service, item *planItem) *checkError {
+	var file *drive.File
+	err := retry(func() (err error) {
+		file, err = srv.Files.Get(item.DestID).Context(ctx).Do()
+		return err
+	})
+	switch {
+	case err != nil:
+		return &checkError{checkFetch, fmt.Sprintf("FILE GET ERROR %v", err)}
+	case file.Title != item.Title:
+		return &checkError{checkName, fmt.Sprintf("NAME ERROR %s != %s", file.Title, item.Title)}
+	case file.Md5Checksum != item.MD5:
+		return &checkError{checkChecksum, fmt.Sprintf("MD5 MISMATCH %s != %s", item.MD5, file.Md5Checksum)}
+	case file.FileSize != item.Size:
+		return &checkError{checkSize, fmt.Sprintf("SIZE MISMATCH %d != %d", item.Size, file.FileSize)}
+	}
+	return nil
+}
+
+func check(srv *drive.Service, account string) error {
+	mp, err := readMigrationPlan()
+	if err != nil {
+		return err
+	}
+
+	// Copied files, checked again if checked before. Copies still shared
+	// are not finished by migrate yet.
+	var items []*planItem
+	shared := 0
+	for _, item := range mp.Files() {
+		if item.DestID == "" || item.State != stateCopied && item.State != stateVerified && item.State != stateFailed {
+			continue
+		}
+		if item.Shared {
+			shared++
+			continue
+		}
+		items = append(items, item)
+	}
+
+	errors := map[string]int{}
+	ok := 0
+
+	// Progress bar
+	bar := pb.New(len(items))
+	bar.SetRefreshRate(time.Second)
+	bar.Start()
+
+	for _, item := range items {
+		if interrupted() {
+			break
+		}
+		bar.Increment()
+		err := checkItem(srv, item)
+		if err != nil {
+			fmt.Printf("\n\n%s ✖ %s\n", item.Path, err.Error())
+			errors[err.Kind]++
+		} else {
+			ok++
+		}
+		uerr := mp.Update(item, func(item *planItem) {
+			if err != nil {
+				item.State = stateFailed
+				item.Error = err.Error()
+				return
+			}
+			item.State = stateVerified
+			item.Error = ""
+		})
+		if uerr != nil {
+			return uerr
+		}
+	}
+
+	bar.FinishPrint("Done.")
+	if err := mp.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("RESULTS:\n%d Checksum errors\n%d Size errors\n%d Name errors\n%d Fetch errors\n%d OK\n", errors[checkChecksum], errors[checkSize], errors[checkName], errors[checkFetch], ok)
+	if shared > 0 {
+		fmt.Printf("%d copies still have permissions to remove, run gdriver migrate %s\n", shared, account)
+	}
+
+	if failed := len(items) - ok + shared; failed > 0 {
+		return &partialError{Failed: failed, Total: len(items) + shared}
+	}
+
+	// Everything is OK
+	return nil
+}
+
+func runCheck(fs *flag.FlagSet, args []string) error {
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	account := args[0]
+
+	srv, err := newService()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Checking files in account %s", account)
+
+	return check(srv, account)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/api/drive/v2"
+)
+
+func TestCheck(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	migrated(t, s)
+
+	if code := gdriver(s, userB, "check", userB); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+
+	spec := byTitle(s.Files(userB), "spec.txt")[0]
+	s.Update(spec.Id, func(f *drive.File) { f.Md5Checksum = "corrupted" })
+
+	if code := gdriver(s, userB, "check", userB); code != exitPartial {
+		t.Fatalf("exit code %d after corrupting a copy, want %d", code, exitPartial)
+	}
+
+	mp, err := readMigrationPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range mp.Files() {
+		want := stateVerified
+		if item.DestID == spec.Id {
+			want = stateFailed
+		}
+		if item.State != want || (want == stateFailed) != (item.Error != "") {
+			t.Errorf("%s is %s (%q), want %s", item.Path, item.State, item.Error, want)
+		}
+	}
+}
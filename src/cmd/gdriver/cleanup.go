@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cheggaaa/pb"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// Remediations of cleanup
+const (
+	fixRemove    = "remove"    // delete the permission
+	fixDowngrade = "downgrade" // make a writer a reader
+	fixToDomain  = "to-domain" // replace anyone by the domain
+)
+
+// cleanupOptions select what cleanup changes.
+type cleanupOptions struct {
+	External string // remove, downgrade (writers only) or keep
+	Anyone   string // domain, remove or keep
+	Domain   string // domain anyone permissions are converted to
+}
+
+// fix is a planned change of one permission.
+type fix struct {
+	Row    *auditRow
+	File   *drive.File
+	Perm   *drive.Permission
+	Action string
+}
+
+// planCleanup returns the changes needed on the file's permissions.
+func planCleanup(path string, f *drive.File, perms []*drive.Permission, allowed map[string]bool, o *cleanupOptions) []*fix {
+	var fixes []*fix
+	for _, p := range perms {
+		if p.Role == "owner" {
+			continue
+		}
+		row := auditPermission(path, f, p, allowed)
+		action := ""
+		switch {
+		case row.AnyoneLink && o.Anyone == "domain":
+			action = fixToDomain
+		case row.AnyoneLink && o.Anyone == "remove":
+			action = fixRemove
+		case row.External && o.External == "remove":
+			action = fixRemove
+		case row.OutsiderWriter && o.External == "downgrade":
+			action = fixDowngrade
+		}
+		if action != "" {
+			fixes = append(fixes, &fix{Row: row, File: f, Perm: p, Action: action})
+		}
+	}
+	return fixes
+}
+
+// writePlan saves the planned changes as CSV for review.
+func writePlan(name string, fixes []*fix) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"Path", "Id", "Grantee", "Type", "Role", "WithLink", "Action"})
+	for _, x := range fixes {
+		r := x.Row
+		w.Write([]string{r.Path, r.FileID, r.Grantee, r.Type, r.Role, fmt.Sprint(r.WithLink), x.Action})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// apply carries out the fix and journals every permission change.
+func (x *fix) apply(srv *drive.Service, o *cleanupOptions, j *journal) error {
+	p := x.Perm
+	entry := func(role, outcome string) *journalEntry {
+		return &journalEntry{
+			FileID:       x.File.Id,
+			Title:        x.File.Title,
+			PermissionID: p.Id,
+			Type:         p.Type,
+			Value:        permissionValue(p),
+			WithLink:     p.WithLink,
+			PreviousRole: roleName(p),
+			Role:         role,
+			Outcome:      outcome,
+		}
+	}
+	record := func(e *journalEntry, err error) error {
+		if err != nil {
+			e.Outcome = shareFailed
+			e.Error = err.Error()
+		}
+		if jerr := j.Write(e); jerr != nil && err == nil {
+			return jerr
+		}
+		return err
+	}
+
+	switch x.Action {
+	case fixDowngrade:
+		patch := rolePermission(&drive.Permission{}, "reader")
+		err := retry(func() error {
+			_, err := srv.Permissions.Patch(x.File.Id, p.Id, patch).Context(ctx).Do()
+			return err
+		})
+		return record(entry("reader", shareDowngraded), err)
+
+	case fixToDomain:
+		// Grant the domain first, so people inside keep access
+		d := rolePermission(&drive.Permission{Type: "domain", Value: o.Domain, WithLink: p.WithLink}, roleName(p))
+		e := &journalEntry{
+			FileID:   x.File.Id,
+			Title:    x.File.Title,
+			Type:     "domain",
+			Value:    o.Domain,
+			WithLink: p.WithLink,
+			Role:     roleName(p),
+			Outcome:  shareInserted,
+		}
+		err := retry(func() error {
+			inserted, err := srv.Permissions.Insert(x.File.Id, d).SendNotificationEmails(false).Context(ctx).Do()
+			if err == nil {
+				e.PermissionID = inserted.Id
+			}
+			return err
+		})
+		if err := record(e, err); err != nil {
+			return err
+		}
+	}
+
+	err := retry(func() error {
+		return srv.Permissions.Delete(x.File.Id, p.Id).Context(ctx).Do()
+	})
+	return record(entry("", shareRemoved), err)
+}
+
+func cleanup(srv *drive.Service, owner string, sc *scope, allowed map[string]bool, o *cleanupOptions, dryRun bool, planFile string, j *journal) error {
+	files, err := sc.files(srv, owner)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Found: %d files or directories\n", len(files))
+
+	// Plan
+	ps := newPaths(srv, files)
+	var fixes []*fix
+	errs := make([]error, len(files))
+	for i, f := range files {
+		if interrupted() {
+			return ctx.Err()
+		}
+		perms, err := filePermissions(srv, f)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		fixes = append(fixes, planCleanup(ps.path(f), f, perms, allowed, o)...)
+	}
+
+	// Files whose permissions can't be read are not cleaned up
+	unread := 0
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if unread == 0 {
+			fmt.Printf("Unable to read permissions of:\n")
+		}
+		fmt.Printf("  %s (%s): %v\n", ps.path(files[i]), files[i].Id, err)
+		unread++
+	}
+
+	counts := map[string]int{}
+	for _, x := range fixes {
+		counts[x.Action]++
+		debugf("%s %s %s (%s)\n", x.Action, x.Row.Path, x.Row.Grantee, x.Row.Role)
+	}
+	fmt.Printf("Plan: remove %d, downgrade %d, convert %d anyone permissions to %s\n",
+		counts[fixRemove], counts[fixDowngrade], counts[fixToDomain], o.Domain)
+
+	if planFile != "" {
+		if err := writePlan(planFile, fixes); err != nil {
+			return err
+		}
+		fmt.Printf("Plan written to %s\n", planFile)
+	}
+	if dryRun || len(fixes) == 0 {
+		if unread > 0 {
+			return &partialError{Failed: unread, Total: len(files)}
+		}
+		return nil
+	}
+
+	// Progress bar
+	bar := pb.New(len(fixes))
+	bar.SetRefreshRate(time.Second)
+	bar.Start()
+
+	failed := 0
+	for _, x := range fixes {
+		if interrupted() {
+			break
+		}
+		bar.Increment()
+		if err := x.apply(srv, o, j); err != nil {
+			fmt.Printf("Cleaning up %s on %s\n", x.Row.Grantee, x.Row.Path)
+			fmt.Printf("cleanup: %s\n", err.Error())
+			failed++
+		}
+	}
+	bar.FinishPrint("Done.")
+
+	if failed+unread > 0 {
+		return &partialError{Failed: failed + unread, Total: len(fixes) + unread}
+	}
+	return nil
+}
+
+func runCleanup(fs *flag.FlagSet, args []string) error {
+	o := &cleanupOptions{}
+	var domains stringList
+	fs.Var(&domains, "allow-domain", "allowed `domain` (repeatable, default the domain of the account)")
+	fs.StringVar(&o.External, "external", "remove", "what to do with permissions of other domains: remove, downgrade (writers to readers) or keep")
+	fs.StringVar(&o.Anyone, "anyone", "domain", "what to do with permissions of anyone: domain (convert to the first allowed domain), remove or keep")
+	dryRun := fs.Bool("dry-run", false, "only show the plan")
+	planFile := fs.String("plan", "", "write the planned changes to the CSV `file`")
+	journalFile := fs.String("journal", defaultJournal("cleanup"), "journal `file` the changes are appended to, for rollback")
+	sc := &scope{}
+	sc.flags(fs)
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	owner := args[0]
+
+	switch {
+	case o.External != "remove" && o.External != "downgrade" && o.External != "keep":
+		err = fmt.Errorf("Unknown --external action %q", o.External)
+	case o.Anyone != "domain" && o.Anyone != "remove" && o.Anyone != "keep":
+		err = fmt.Errorf("Unknown --anyone action %q", o.Anyone)
+	default:
+		err = sc.validate()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n", err)
+		fs.Usage()
+		return errUsage
+	}
+
+	if len(domains) == 0 {
+		domains = append(domains, domainOf(owner))
+	}
+	allowed := map[string]bool{}
+	for _, d := range domains {
+		allowed[strings.ToLower(d)] = true
+	}
+	o.Domain = strings.ToLower(domains[0])
+
+	srv, err := newService()
+	if err != nil {
+		return err
+	}
+
+	var j *journal
+	if !*dryRun {
+		if j, err = openJournal(*journalFile); err != nil {
+			return err
+		}
+		defer j.Close()
+		log.Printf("Journal: %s", *journalFile)
+	}
+
+	log.Printf("Cleaning up sharing of files owned by %s outside %s", owner, strings.Join(domains, ", "))
+
+	return cleanup(srv, owner, sc, allowed, o, *dryRun, *planFile, j)
+}
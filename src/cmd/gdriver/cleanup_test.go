@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/csv"
+	"gdrive/fakedrive"
+	"os"
+	"testing"
+
+	"google.golang.org/api/drive/v2"
+)
+
+func TestCleanup(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	files := s.Files(userA)
+	readme := byTitle(files, "readme.txt")[0]
+	spec := byTitle(files, "spec.txt")[0]
+	s.Update(readme.Id, func(f *drive.File) {
+		f.Permissions = append(f.Permissions, &drive.Permission{Id: "anyoneWithLink", Type: "anyone", Role: "writer", WithLink: true})
+	})
+	s.Share(spec.Id, "mallory@other.com", "writer")
+	s.Share(spec.Id, "eve@other.com", "reader")
+
+	// userB is in the same domain as userA
+	if code := gdriver(s, userA, "cleanup", "--dry-run", "--plan", "plan.csv", userA); code != exitOK {
+		t.Fatalf("dry run exit code %d", code)
+	}
+	f, err := os.Open("plan.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(f).ReadAll()
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Errorf("%d plan lines, want header and 3 changes: %v", len(records), records)
+	}
+	if n := s.Calls("drive.permissions.delete"); n != 0 {
+		t.Fatalf("dry run deleted %d permissions", n)
+	}
+
+	if code := gdriver(s, userA, "cleanup", "--external", "downgrade", "--journal", "cleanup.jsonl", userA); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	after := grantees(s.File(spec.Id))
+	if after["mallory@other.com"] != "reader" || after["eve@other.com"] != "reader" || after[userB] != "reader" {
+		t.Errorf("spec.txt after downgrade: %v", after)
+	}
+	after = grantees(s.File(readme.Id))
+	if _, ok := after["anyone"]; ok || after["example.com"] != "writer" {
+		t.Errorf("readme.txt after converting anyone: %v", after)
+	}
+
+	if code := gdriver(s, userA, "cleanup", "--journal", "cleanup.jsonl", userA); code != exitOK {
+		t.Fatalf("remove: exit code %d", code)
+	}
+	after = grantees(s.File(spec.Id))
+	if _, ok := after["eve@other.com"]; ok {
+		t.Errorf("external reader not removed: %v", after)
+	}
+
+	if code := gdriver(s, userA, "rollback", "cleanup.jsonl"); code != exitOK {
+		t.Fatalf("rollback exit code %d", code)
+	}
+	after = grantees(s.File(readme.Id))
+	if after["anyone"] != "writer" {
+		t.Errorf("anyone link not restored: %v", after)
+	}
+	if _, ok := after["example.com"]; ok {
+		t.Errorf("domain permission not removed: %v", after)
+	}
+	if r := grantees(s.File(spec.Id))["mallory@other.com"]; r != "writer" {
+		t.Errorf("mallory is %q after rollback, want writer", r)
+	}
+}
+
+func TestCleanupFailure(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	files := s.Files(userA)
+	for _, f := range files {
+		s.Share(f.Id, "mallory@other.com", "reader")
+	}
+	s.OmitListPermissions = true
+	s.AddFault(fakedrive.Fault{Op: "drive.permissions.list", Code: 404, Reason: "notFound", Times: 1})
+
+	if code := gdriver(s, userA, "cleanup", "--journal", "cleanup.jsonl", userA); code != exitPartial {
+		t.Fatalf("exit code %d, want %d", code, exitPartial)
+	}
+	if n, want := s.Calls("drive.permissions.delete"), len(files)-1; n != want {
+		t.Errorf("%d permissions removed, want %d", n, want)
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gdrive"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"google.golang.org/api/drive/v2"
+)
+
+type file struct {
+	ID          string
+	Title       string
+	MimeType    string
+	MD5Checksum string
+}
+
+type folder struct {
+	ID      string
+	Title   string
+	Folders []folder
+	Files   []file
+}
+
+type node struct {
+	ID          string
+	Title       string
+	MimeType    string
+	MD5Checksum string
+	Path        string
+}
+
+func gdriveFolderExists(srv *drive.Service, id string) (bool, error) {
+	var file *drive.File
+
+	err := retry(func() (err error) {
+		file, err = srv.Files.Get(id).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if file.MimeType != gdrive.FolderMIME {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func gdriveChildren(srv *drive.Service, folderID string) ([]folder, []file, error) {
+	var cs []*drive.ChildReference
+
+	pageToken := ""
+	for {
+		q := srv.Children.List(folderID)
+		if pageToken != "" {
+			q = q.PageToken(pageToken)
+		}
+		var r *drive.ChildList
+		err := retry(func() (err error) {
+			r, err = q.Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		cs = append(cs, r.Items...)
+		pageToken = r.NextPageToken
+		if pageToken == "" {
+			break
+		}
+	}
+
+	folders := []folder{}
+	files := []file{}
+	var node *drive.File
+
+	for _, c := range cs {
+		err := retry(func() (err error) {
+			node, err = srv.Files.Get(c.Id).Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if node.MimeType == gdrive.FolderMIME {
+			folders = append(folders, folder{ID: node.Id, Title: node.Title})
+		} else {
+			files = append(files, file{ID: node.Id, Title: node.Title, MimeType: node.MimeType, MD5Checksum: node.Md5Checksum})
+		}
+	}
+
+	return folders, files, nil
+}
+
+// gdriveTree reads the tree below the folder. A folder reached again,
+// through a cycle of parents or a second parent, is reported and listed
+// without its contents.
+func gdriveTree(srv *drive.Service, rootID string, f *folder, seen map[string]bool) error {
+	fmt.Fprint(os.Stderr, ".")
+	folders, files, err := gdriveChildren(srv, rootID)
+	if err != nil {
+		return err
+	}
+
+	for i, n := range folders {
+		if seen[n.ID] {
+			fmt.Fprintf(os.Stderr, "\nFolder %s (%s) reached again, not descending into it\n", n.Title, n.ID)
+			continue
+		}
+		seen[n.ID] = true
+		err = gdriveTree(srv, n.ID, &folders[i], seen)
+		if err != nil {
+			return err
+		}
+	}
+
+	f.Files = append(f.Files, files...)
+	f.Folders = append(f.Folders, folders...)
+
+	return nil
+}
+
+func generateTree(srv *drive.Service, rootID string) (*folder, error) {
+	var tree folder
+
+	exists, err := gdriveFolderExists(srv, rootID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("Folder %s does not exist or is not a folder", rootID)
+	}
+
+	err = gdriveTree(srv, rootID, &tree, map[string]bool{rootID: true})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tree, nil
+}
+
+func flattenTree(prefix string, t *folder) []node {
+	var nodes []node
+
+	if t == nil {
+		return nodes
+	}
+
+	for _, n := range t.Files {
+		nodes = append(nodes, node{
+			ID:          n.ID,
+			Title:       n.Title,
+			MimeType:    n.MimeType,
+			MD5Checksum: n.MD5Checksum,
+			Path:        fmt.Sprintf("%s%s", prefix, n.Title),
+		})
+	}
+
+	for _, n := range t.Folders {
+		node := node{
+			ID:          n.ID,
+			Title:       n.Title + "/",
+			MimeType:    gdrive.FolderMIME,
+			MD5Checksum: "0",
+			Path:        fmt.Sprintf("%s%s/", prefix, n.Title),
+		}
+		nodes = append(nodes, node)
+
+		sub := flattenTree(node.Path, &n)
+		if sub != nil {
+			nodes = append(nodes, sub...)
+		}
+
+	}
+
+	return nodes
+}
+
+// Kinds of differences between two trees
+const (
+	onlyInA   = "only-in-a"
+	onlyInB   = "only-in-b"
+	mimeDiff  = "mime"
+	md5Diff   = "md5"
+	duplicate = "duplicate"
+)
+
+// difference is a path which is not the same in both trees. A and B are
+// the differing values: the MIME types, the MD5 checksums or the number
+// of items sharing the path.
+type difference struct {
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+	AID  string `json:"aId,omitempty"`
+	BID  string `json:"bId,omitempty"`
+	A    string `json:"a,omitempty"`
+	B    string `json:"b,omitempty"`
+}
+
+// byPath groups nodes by their path. Drive allows several items with
+// the same title in a folder, so one path can hold more nodes.
+func byPath(nodes []node) (map[string][]node, []string) {
+	m := map[string][]node{}
+	var paths []string
+	for _, n := range nodes {
+		if _, ok := m[n.Path]; !ok {
+			paths = append(paths, n.Path)
+		}
+		m[n.Path] = append(m[n.Path], n)
+	}
+	return m, paths
+}
+
+// diffTrees compares two flattened trees by path.
+func diffTrees(a, b []node) []difference {
+	ma, pathsA := byPath(a)
+	mb, pathsB := byPath(b)
+
+	paths := pathsA
+	for _, p := range pathsB {
+		if _, ok := ma[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	var diffs []difference
+	for _, p := range paths {
+		na, nb := ma[p], mb[p]
+		switch {
+		case len(na) == 0:
+			diffs = append(diffs, difference{Kind: onlyInB, Path: p, BID: nb[0].ID})
+			continue
+		case len(nb) == 0:
+			diffs = append(diffs, difference{Kind: onlyInA, Path: p, AID: na[0].ID})
+			continue
+		case len(na) > 1 || len(nb) > 1:
+			// Can't tell which items correspond to each other
+			diffs = append(diffs, difference{Kind: duplicate, Path: p,
+				A: strconv.Itoa(len(na)), B: strconv.Itoa(len(nb))})
+			continue
+		}
+
+		x, y := na[0], nb[0]
+		if x.MimeType != y.MimeType {
+			diffs = append(diffs, difference{Kind: mimeDiff, Path: p, AID: x.ID, BID: y.ID, A: x.MimeType, B: y.MimeType})
+		} else if x.MD5Checksum != y.MD5Checksum {
+			diffs = append(diffs, difference{Kind: md5Diff, Path: p, AID: x.ID, BID: y.ID, A: x.MD5Checksum, B: y.MD5Checksum})
+		}
+	}
+	return diffs
+}
+
+// countNodes returns the number of files and folders.
+func countNodes(nodes []node) (files, folders int) {
+	for _, n := range nodes {
+		if n.MimeType == gdrive.FolderMIME {
+			folders++
+		} else {
+			files++
+		}
+	}
+	return files, folders
+}
+
+func writeDiffText(w io.Writer, a, b []node, diffs []difference) error {
+	files, folders := countNodes(a)
+	fmt.Fprintf(w, "A: Found %d files and %d folders\n", files, folders)
+	files, folders = countNodes(b)
+	fmt.Fprintf(w, "B: Found %d files and %d folders\n", files, folders)
+
+	for _, d := range diffs {
+		switch d.Kind {
+		case onlyInA:
+			fmt.Fprintf(w, "Only in A: %s\n", d.Path)
+		case onlyInB:
+			fmt.Fprintf(w, "Only in B: %s\n", d.Path)
+		case mimeDiff:
+			fmt.Fprintf(w, "MIME type differs: %s (%s, %s)\n", d.Path, d.A, d.B)
+		case md5Diff:
+			fmt.Fprintf(w, "MD5 differs: %s (%s, %s)\n", d.Path, d.A, d.B)
+		case duplicate:
+			fmt.Fprintf(w, "Duplicate title: %s (%s in A, %s in B)\n", d.Path, d.A, d.B)
+		}
+	}
+
+	if len(diffs) == 0 {
+		_, err := fmt.Fprintf(w, "Trees are identical\n")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d differences\n", len(diffs))
+	return err
+}
+
+func writeDiffJSON(w io.Writer, diffs []difference) error {
+	if diffs == nil {
+		diffs = []difference{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diffs)
+}
+
+func writeDiffCSV(w io.Writer, diffs []difference) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Kind", "Path", "A:Id", "B:Id", "A", "B"})
+	for _, d := range diffs {
+		cw.Write([]string{d.Kind, d.Path, d.AID, d.BID, d.A, d.B})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func compare(srv *drive.Service, id1, id2, format string) error {
+	tree1, err := generateTree(srv, id1)
+	if err != nil {
+		return err
+	}
+	flat1 := flattenTree("/", tree1)
+
+	tree2, err := generateTree(srv, id2)
+	if err != nil {
+		return err
+	}
+	flat2 := flattenTree("/", tree2)
+	fmt.Fprintln(os.Stderr)
+
+	diffs := diffTrees(flat1, flat2)
+	switch format {
+	case "json":
+		err = writeDiffJSON(os.Stdout, diffs)
+	case "csv":
+		err = writeDiffCSV(os.Stdout, diffs)
+	default:
+		err = writeDiffText(os.Stdout, flat1, flat2, diffs)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(diffs) > 0 {
+		return errDiffer
+	}
+	return nil
+}
+
+func runCompare(fs *flag.FlagSet, args []string) error {
+	format := fs.String("format", "text", "output `format`: text, json or csv")
+	args, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "text", "json", "csv":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format %q\n\n", *format)
+		fs.Usage()
+		return errUsage
+	}
+
+	srv, err := newService()
+	if err != nil {
+		return err
+	}
+
+	return compare(srv, args[0], args[1], *format)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/drive/v2"
+)
+
+func TestCompare(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	projects, _ := fixture(s)
+	migrated(t, s)
+
+	copy := byTitle(s.Files(userB), "Projects")[0]
+	if code := gdriver(s, userB, "compare", projects, copy.Id); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+}
+
+func TestCompareNotFolder(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+
+	readme := byTitle(s.Files(userA), "readme.txt")[0]
+	if code := gdriver(s, userA, "compare", readme.Id, readme.Id); code != exitFailure {
+		t.Fatalf("exit code %d, want %d", code, exitFailure)
+	}
+}
+
+func TestCompareDiffer(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	projects, _ := fixture(s)
+	migrated(t, s)
+
+	files := s.Files(userB)
+	copy := byTitle(files, "Projects")[0]
+	s.Update(byTitle(files, "spec.txt")[0].Id, func(f *drive.File) { f.Md5Checksum = "changed" })
+	s.AddFile(userB, "extra.txt", copy.Id, "extra")
+	dup := s.AddFile(userA, "readme.txt", projects, "second readme")
+	s.Share(dup.Id, userB, "reader")
+
+	for _, format := range []string{"text", "json", "csv"} {
+		if code := gdriver(s, userB, "compare", "--format", format, projects, copy.Id); code != exitDiffer {
+			t.Errorf("%s: exit code %d, want %d", format, code, exitDiffer)
+		}
+	}
+	if code := gdriver(s, userB, "compare", "--format", "xml", projects, copy.Id); code != exitUsage {
+		t.Errorf("unknown format: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+func TestDiffTrees(t *testing.T) {
+	a := []node{
+		{ID: "a1", Path: "/same.txt", MimeType: "text/plain", MD5Checksum: "1"},
+		{ID: "a2", Path: "/md5.txt", MimeType: "text/plain", MD5Checksum: "1"},
+		{ID: "a3", Path: "/mime", MimeType: "text/plain"},
+		{ID: "a4", Path: "/only-a.txt"},
+		{ID: "a5", Path: "/dup.txt"},
+		{ID: "a6", Path: "/dup.txt"},
+	}
+	b := []node{
+		{ID: "b1", Path: "/same.txt", MimeType: "text/plain", MD5Checksum: "1"},
+		{ID: "b2", Path: "/md5.txt", MimeType: "text/plain", MD5Checksum: "2"},
+		{ID: "b3", Path: "/mime", MimeType: "application/pdf"},
+		{ID: "b4", Path: "/only-b.txt"},
+		{ID: "b5", Path: "/dup.txt"},
+	}
+
+	want := []difference{
+		{Kind: duplicate, Path: "/dup.txt", A: "2", B: "1"},
+		{Kind: md5Diff, Path: "/md5.txt", AID: "a2", BID: "b2", A: "1", B: "2"},
+		{Kind: mimeDiff, Path: "/mime", AID: "a3", BID: "b3", A: "text/plain", B: "application/pdf"},
+		{Kind: onlyInA, Path: "/only-a.txt", AID: "a4"},
+		{Kind: onlyInB, Path: "/only-b.txt", BID: "b4"},
+	}
+	got := diffTrees(a, b)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffTrees =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestCompareCycle(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	projects, acme := fixture(s)
+	// Projects is also in ACME, below itself
+	s.Update(projects, func(f *drive.File) {
+		f.Parents = append(f.Parents, &drive.ParentReference{Id: acme})
+	})
+
+	if code := gdriver(s, userA, "compare", projects, projects); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"gdrive"
+	"strings"
+
+	"google.golang.org/api/drive/v2"
+)
+
+func findAllFilesFrom(srv *drive.Service, owner string) ([]*drive.File, error) {
+	return listFiles(srv, "'"+owner+"' in owners")
+}
+
+// findFilesInFolder returns the folder and everything below it owned by
+// owner. Folders of other users are searched too.
+func findFilesInFolder(srv *drive.Service, folderID, owner string) ([]*drive.File, error) {
+	var root *drive.File
+	err := retry(func() (err error) {
+		root, err = srv.Files.Get(folderID).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Files with several parents in the folder, and folders in a cycle
+	// of parents, are found more than once
+	var f []*drive.File
+	seen := map[string]bool{root.Id: true}
+	queue := []*drive.File{root}
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		if ownedBy(file, owner) {
+			f = append(f, file)
+		}
+		if file.MimeType != gdrive.FolderMIME {
+			continue
+		}
+
+		children, err := listFiles(srv, "'"+file.Id+"' in parents and trashed = false")
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range children {
+			if !seen[c.Id] {
+				seen[c.Id] = true
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	return f, nil
+}
+
+func ownedBy(file *drive.File, owner string) bool {
+	for _, o := range file.Owners {
+		if strings.EqualFold(o.EmailAddress, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// propertyQuery returns the query of files with the private property.
+func propertyQuery(key, value string) string {
+	return fmt.Sprintf("properties has { key=%s and value=%s and visibility='PRIVATE' } and trashed = false",
+		quote(key), quote(value))
+}
+
+// listFiles returns all files matching the query.
+func listFiles(srv *drive.Service, query string) ([]*drive.File, error) {
+	var f []*drive.File
+
+	pageToken := ""
+	for {
+		q := srv.Files.List().Q(query).MaxResults(1000)
+		// If we have a pageToken set, apply it to the query
+		if pageToken != "" {
+			q = q.PageToken(pageToken)
+		}
+
+		var r *drive.FileList
+		err := retry(func() (err error) {
+			r, err = q.Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		f = append(f, r.Items...)
+
+		pageToken = r.NextPageToken
+		if pageToken == "" {
+			break
+		}
+	}
+
+	return f, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// folderMapFile is the name of the folder map in the working directory.
+// It is bookkeeping of prepare, hidden next to the plan users review.
+const folderMapFile = ".folders.jsonl"
+
+// folderMapping is a line of the folder map. The line without a source
+// records the destination root, the line with FromPlan that a reviewed
+// plan is executed and the line with Done the end of prepare.
+type folderMapping struct {
+	Source   string `json:"source,omitempty"`
+	Dest     string `json:"dest,omitempty"`
+	Title    string `json:"title,omitempty"`
+	FromPlan bool   `json:"fromPlan,omitempty"`
+	Done     bool   `json:"done,omitempty"`
+}
+
+// folderMap maps source folders to the folders created for them. Every
+// mapping is written through as it is added, so an interrupted prepare
+// can be resumed without creating the folders again.
+type folderMap struct {
+	Root     string            // destination root folder ID
+	Folders  map[string]string // source ID -> destination ID
+	FromPlan bool              // executing the stored plan
+	Done     bool              // prepare finished
+
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// openFolderMap reads the folder map of the working directory, if any,
+// and opens it for appending.
+func openFolderMap() (*folderMap, error) {
+	name := filepath.Join(workDir, folderMapFile)
+	m := &folderMap{Folders: map[string]string{}}
+
+	f, err := os.Open(name)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for n := 1; scanner.Scan(); n++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			e := &folderMapping{}
+			if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s:%d: %v", name, n, err)
+			}
+			switch {
+			case e.Done:
+				m.Done = true
+			case e.FromPlan:
+				m.FromPlan = true
+			case e.Source == "":
+				m.Root = e.Dest
+			default:
+				m.Folders[e.Source] = e.Dest
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	m.f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open folder map: %v", err)
+	}
+	m.enc = json.NewEncoder(m.f)
+	return m, nil
+}
+
+func (m *folderMap) write(e *folderMapping) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.enc.Encode(e); err != nil {
+		return fmt.Errorf("Unable to write folder map: %v", err)
+	}
+	return nil
+}
+
+// SetRoot records the destination root folder.
+func (m *folderMap) SetRoot(id string) error {
+	m.Root = id
+	return m.write(&folderMapping{Dest: id})
+}
+
+// Add records the folder created for a source folder.
+func (m *folderMap) Add(source, dest, title string) error {
+	m.mu.Lock()
+	m.Folders[source] = dest
+	m.mu.Unlock()
+	return m.write(&folderMapping{Source: source, Dest: dest, Title: title})
+}
+
+// Dest returns the folder created for the source folder, the root for
+// rootParent.
+func (m *folderMap) Dest(source string) (string, bool) {
+	if source == rootParent {
+		return m.Root, true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.Folders[source]
+	return id, ok
+}
+
+// SetFromPlan records that prepare executes the stored plan, which a
+// resumed prepare must not build again.
+func (m *folderMap) SetFromPlan() error {
+	m.FromPlan = true
+	return m.write(&folderMapping{FromPlan: true})
+}
+
+// Finish records that prepare finished.
+func (m *folderMap) Finish() error {
+	m.Done = true
+	return m.write(&folderMapping{Done: true})
+}
+
+func (m *folderMap) Close() error {
+	return m.f.Close()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"gdrive"
+	"sort"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// Placements of folders and files whose parents are outside the folders
+// of the account
+const (
+	outsideRoot  = "root"  // put them under the migration root
+	outsideStubs = "stubs" // recreate the outside ancestors
+	outsideSkip  = "skip"  // leave them out and report them
+)
+
+// rootParent stands for the destination root among planned parents.
+const rootParent = ""
+
+// folderPlan orders the folders of the account for creation. Folders of
+// a level only have parents in the levels before it, so the folders of
+// one level can be created in parallel.
+type folderPlan struct {
+	Levels      [][]*drive.File
+	Skipped     []*drive.File // only parents outside the account
+	Cycles      []*drive.File // folders which are their own ancestors
+	Unreachable []*drive.File // below skipped folders or cycles
+
+	folders     map[string]*drive.File
+	planned     map[string]bool
+	skipOutside bool
+}
+
+// parentIDs returns the distinct parent IDs of the file, without the
+// root.
+func parentIDs(f *drive.File) []string {
+	var ids []string
+	seen := map[string]bool{}
+	for _, ref := range f.Parents {
+		if !ref.IsRoot && !seen[ref.Id] {
+			seen[ref.Id] = true
+			ids = append(ids, ref.Id)
+		}
+	}
+	return ids
+}
+
+// parents returns the source IDs of the planned parents of the file,
+// rootParent for the destination root. It returns none when the file
+// has no place in the destination.
+func (p *folderPlan) parents(f *drive.File) []string {
+	var ids []string
+	root := len(f.Parents) == 0
+	outside := false
+	for _, ref := range f.Parents {
+		if ref.IsRoot {
+			root = true
+		}
+	}
+	for _, id := range parentIDs(f) {
+		switch {
+		case p.planned[id]:
+			ids = append(ids, id)
+		case p.folders[id] == nil:
+			outside = true
+		}
+	}
+	if outside && len(ids) == 0 && !p.skipOutside {
+		root = true
+	}
+	if root {
+		ids = append(ids, rootParent)
+	}
+	return ids
+}
+
+// inside reports whether the file has a parent among the folders.
+func (p *folderPlan) inside(f *drive.File) bool {
+	for _, id := range parentIDs(f) {
+		if p.folders[id] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// planFolders builds the folder graph once and sorts the folders into
+// levels, parents first. Parents outside the folders are skipped with
+// skipOutside, otherwise they are replaced by the root.
+func planFolders(folders map[string]*drive.File, skipOutside bool) *folderPlan {
+	p := &folderPlan{folders: folders, planned: map[string]bool{}, skipOutside: skipOutside}
+
+	children := map[string][]string{}
+	waiting := map[string]int{} // parents not planned yet
+	for id, f := range folders {
+		for _, parent := range parentIDs(f) {
+			if folders[parent] != nil {
+				children[parent] = append(children[parent], id)
+				waiting[id]++
+			}
+		}
+	}
+
+	var level []string
+	for id := range folders {
+		if waiting[id] == 0 {
+			level = append(level, id)
+		}
+	}
+	for len(level) > 0 {
+		sort.Strings(level)
+		var created []*drive.File
+		var next []string
+		for _, id := range level {
+			f := folders[id]
+			switch {
+			case len(p.parents(f)) > 0:
+				created = append(created, f)
+			case p.inside(f):
+				p.Unreachable = append(p.Unreachable, f)
+			default:
+				p.Skipped = append(p.Skipped, f)
+			}
+			for _, c := range children[id] {
+				if waiting[c]--; waiting[c] == 0 {
+					next = append(next, c)
+				}
+			}
+		}
+		// Planned after the level, siblings don't depend on each other
+		for _, f := range created {
+			p.planned[f.Id] = true
+		}
+		if len(created) > 0 {
+			p.Levels = append(p.Levels, created)
+		}
+		level = next
+	}
+
+	// Folders still waiting are in a cycle or below one
+	var rest []string
+	for id := range folders {
+		if waiting[id] > 0 {
+			rest = append(rest, id)
+		}
+	}
+	sort.Strings(rest)
+	for _, id := range rest {
+		if p.ancestor(id, id, map[string]bool{}) {
+			p.Cycles = append(p.Cycles, folders[id])
+		} else {
+			p.Unreachable = append(p.Unreachable, folders[id])
+		}
+	}
+	return p
+}
+
+// ancestor reports whether id is an ancestor of the folder of.
+func (p *folderPlan) ancestor(id, of string, seen map[string]bool) bool {
+	for _, parent := range parentIDs(p.folders[of]) {
+		if parent == id {
+			return true
+		}
+		if p.folders[parent] == nil || seen[parent] {
+			continue
+		}
+		seen[parent] = true
+		if p.ancestor(id, parent, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// addStubs adds the folders outside the account the files are in to
+// the folders, up to the first one the destination account can't see.
+// It returns the IDs of the added folders.
+func addStubs(srv *drive.Service, folders map[string]*drive.File, files []*drive.File) (map[string]bool, error) {
+	stubs := map[string]bool{}
+	seen := map[string]bool{}
+	var queue []string
+	enqueue := func(f *drive.File) {
+		for _, id := range parentIDs(f) {
+			if folders[id] == nil && !seen[id] {
+				seen[id] = true
+				queue = append(queue, id)
+			}
+		}
+	}
+	for _, f := range files {
+		enqueue(f)
+	}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		var f *drive.File
+		err := retry(func() (err error) {
+			f, err = srv.Files.Get(id).Context(ctx).Do()
+			return err
+		})
+		if isNotFound(err) {
+			debugf("Parent %s is not visible, using the root\n", id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if f.MimeType != gdrive.FolderMIME {
+			continue
+		}
+		folders[id] = f
+		stubs[id] = true
+		enqueue(f)
+	}
+	return stubs, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/drive/v2"
+)
+
+func newFolder(id string, parents ...string) *drive.File {
+	f := &drive.File{Id: id, Title: id}
+	for _, p := range parents {
+		f.Parents = append(f.Parents, &drive.ParentReference{Id: p, IsRoot: p == "root"})
+	}
+	return f
+}
+
+func ids(files []*drive.File) []string {
+	var ids []string
+	for _, f := range files {
+		ids = append(ids, f.Id)
+	}
+	return ids
+}
+
+func TestPlanFolders(t *testing.T) {
+	folders := map[string]*drive.File{}
+	for _, f := range []*drive.File{
+		newFolder("a", "root"),
+		newFolder("b", "a"),
+		newFolder("c", "b"),
+		newFolder("d", "a", "c"),
+		newFolder("x", "y"),
+		newFolder("y", "x"),
+		newFolder("z", "x"),
+		newFolder("o", "outside"),
+		newFolder("p", "o"),
+	} {
+		folders[f.Id] = f
+	}
+
+	for _, tt := range []struct {
+		skip        bool
+		levels      [][]string
+		skipped     []string
+		unreachable []string
+	}{
+		{false, [][]string{{"a", "o"}, {"b", "p"}, {"c"}, {"d"}}, nil, []string{"z"}},
+		{true, [][]string{{"a"}, {"b"}, {"c"}, {"d"}}, []string{"o"}, []string{"p", "z"}},
+	} {
+		p := planFolders(folders, tt.skip)
+		var levels [][]string
+		for _, l := range p.Levels {
+			levels = append(levels, ids(l))
+		}
+		if !reflect.DeepEqual(levels, tt.levels) {
+			t.Errorf("skip %v: levels %v, want %v", tt.skip, levels, tt.levels)
+		}
+		if got := ids(p.Skipped); !reflect.DeepEqual(got, tt.skipped) {
+			t.Errorf("skip %v: skipped %v, want %v", tt.skip, got, tt.skipped)
+		}
+		if got := ids(p.Cycles); !reflect.DeepEqual(got, []string{"x", "y"}) {
+			t.Errorf("skip %v: cycles %v, want [x y]", tt.skip, got)
+		}
+		if got := ids(p.Unreachable); !reflect.DeepEqual(got, tt.unreachable) {
+			t.Errorf("skip %v: unreachable %v, want %v", tt.skip, got, tt.unreachable)
+		}
+		if got := p.parents(folders["d"]); !reflect.DeepEqual(got, []string{"a", "c"}) {
+			t.Errorf("skip %v: parents of d %v", tt.skip, got)
+		}
+	}
+}
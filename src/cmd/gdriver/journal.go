@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cheggaaa/pb"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// journalEntry is one permission change, a line of the journal. The
+// previous role is empty when the permission did not exist before.
+type journalEntry struct {
+	Time         time.Time `json:"time"`
+	FileID       string    `json:"fileId"`
+	Title        string    `json:"title"`
+	PermissionID string    `json:"permissionId,omitempty"`
+	Type         string    `json:"type"`
+	Value        string    `json:"value,omitempty"`
+	WithLink     bool      `json:"withLink,omitempty"`
+	PreviousRole string    `json:"previousRole,omitempty"`
+	Role         string    `json:"role"`
+	Outcome      string    `json:"outcome"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// journal appends entries to a file, one JSON object per line. Entries
+// are written through immediately so an interrupted run can be rolled
+// back up to the last change.
+type journal struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func openJournal(name string) (*journal, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open journal: %v", err)
+	}
+	return &journal{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (j *journal) Write(e *journalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if err := j.enc.Encode(e); err != nil {
+		return fmt.Errorf("Unable to write journal: %v", err)
+	}
+	return nil
+}
+
+func (j *journal) Close() error {
+	return j.f.Close()
+}
+
+// defaultJournal returns a new journal name for a run of the command.
+func defaultJournal(command string) string {
+	return fmt.Sprintf("%s-%s.jsonl", command, time.Now().Format("20060102-150405"))
+}
+
+func readJournal(name string) ([]*journalEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*journalEntry
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		e := &journalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// roleName returns the role of the permission as given to share.
+func roleName(p *drive.Permission) string {
+	if roleRank(p) == 2 {
+		return "commenter"
+	}
+	return p.Role
+}
+
+// rolePermission sets the role and additional roles of p from a role
+// name. Additional roles are always sent, so a commenter loses them.
+func rolePermission(p *drive.Permission, role string) *drive.Permission {
+	p.Role = role
+	p.AdditionalRoles = []string{}
+	if role == "commenter" {
+		p.Role = "reader"
+		p.AdditionalRoles = []string{"commenter"}
+	}
+	p.ForceSendFields = []string{"AdditionalRoles"}
+	return p
+}
+
+// undo restores the permission state before the journaled change.
+func undo(srv *drive.Service, e *journalEntry) error {
+	switch {
+	case e.Outcome == shareSkipped || e.Outcome == shareFailed:
+		return nil
+	case e.Outcome == shareTransferred || e.Outcome == shareWriterLeft:
+		return fmt.Errorf("only %s can transfer the ownership back", e.Value)
+	case e.PreviousRole == "":
+		// The permission was added
+		err := retry(func() error {
+			return srv.Permissions.Delete(e.FileID, e.PermissionID).Context(ctx).Do()
+		})
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	case e.Role == "":
+		// The permission was removed
+		p := rolePermission(&drive.Permission{Type: e.Type, Value: e.Value, WithLink: e.WithLink}, e.PreviousRole)
+		return retry(func() error {
+			_, err := srv.Permissions.Insert(e.FileID, p).SendNotificationEmails(false).Context(ctx).Do()
+			return err
+		})
+	}
+	p := rolePermission(&drive.Permission{}, e.PreviousRole)
+	return retry(func() error {
+		_, err := srv.Permissions.Patch(e.FileID, e.PermissionID, p).Context(ctx).Do()
+		return err
+	})
+}
+
+func rollback(srv *drive.Service, entries []*journalEntry) error {
+	fmt.Printf("Rolling back %d journal entries\n", len(entries))
+
+	// Progress bar
+	bar := pb.New(len(entries))
+	bar.SetRefreshRate(time.Second)
+	bar.Start()
+
+	// Undo the latest change first
+	failed := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if interrupted() {
+			break
+		}
+		bar.Increment()
+		e := entries[i]
+		if err := undo(srv, e); err != nil {
+			fmt.Printf("Rolling back %s on %s (%s)\n", e.Outcome, e.Title, e.FileID)
+			fmt.Printf("rollback: %s\n", err.Error())
+			failed++
+		}
+	}
+	bar.FinishPrint("Done.")
+
+	if failed > 0 {
+		return &partialError{Failed: failed, Total: len(entries)}
+	}
+	return nil
+}
+
+func runRollback(fs *flag.FlagSet, args []string) error {
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	entries, err := readJournal(args[0])
+	if err != nil {
+		return err
+	}
+
+	srv, err := newService()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Rolling back %s", args[0])
+
+	return rollback(srv, entries)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/api/drive/v2"
+)
+
+func TestRollback(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+
+	reader := s.AddFile(userA, "reader.txt", "", "a")
+	commenter := s.AddFile(userA, "commenter.txt", "", "b")
+	fresh := s.AddFile(userA, "new.txt", "", "c")
+	s.Share(reader.Id, userB, "reader")
+	s.Share(commenter.Id, userB, "reader")
+	s.Update(commenter.Id, func(f *drive.File) {
+		f.Permissions[len(f.Permissions)-1].AdditionalRoles = []string{"commenter"}
+	})
+
+	if code := gdriver(s, userA, "share", "--journal", "share.jsonl", "--role", "writer", userA, userB); code != exitOK {
+		t.Fatalf("share exit code %d", code)
+	}
+	entries, err := readJournal("share.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("%d journal entries, want 3", len(entries))
+	}
+	for _, e := range entries {
+		if e.FileID == fresh.Id && (e.Outcome != shareInserted || e.PreviousRole != "" || e.PermissionID == "") {
+			t.Errorf("new.txt journaled as %+v", e)
+		}
+		if e.FileID == commenter.Id && (e.Outcome != shareUpgraded || e.PreviousRole != "commenter") {
+			t.Errorf("commenter.txt journaled as %+v", e)
+		}
+	}
+
+	if code := gdriver(s, userA, "rollback", "share.jsonl"); code != exitOK {
+		t.Fatalf("rollback exit code %d", code)
+	}
+	for id, want := range map[string]string{reader.Id: "reader", commenter.Id: "commenter", fresh.Id: ""} {
+		f := s.File(id)
+		got := ""
+		for _, p := range f.Permissions {
+			if p.EmailAddress == userB {
+				got = roleName(p)
+			}
+		}
+		if got != want {
+			t.Errorf("%s: %s has role %q after rollback, want %q", f.Title, userB, got, want)
+		}
+	}
+}
+
+func TestRollbackMissingJournal(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+
+	if code := gdriver(s, userA, "rollback", "nosuchjournal.jsonl"); code != exitFailure {
+		t.Fatalf("exit code %d, want %d", code, exitFailure)
+	}
+}
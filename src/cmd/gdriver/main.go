@@ -0,0 +1,375 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gdrive"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v2"
+	"google.golang.org/api/googleapi"
+)
+
+// Exit codes shared by all commands, so scripts can tell usage errors
+// from API failures from partial successes.
+const (
+	exitOK          = 0
+	exitFailure     = 1   // Drive API or local I/O failure
+	exitUsage       = 2   // invalid command line
+	exitPartial     = 3   // command finished but some items failed
+	exitDiffer      = 4   // compare found differences
+	exitInterrupted = 130 // stopped by Ctrl+C
+)
+
+// Global flags
+var (
+	clientSecretFile = gdrive.FileClientSecret
+	tokenDir         = gdrive.DefaultTokenDir()
+	account          = ""
+	headless         = false
+	serviceAccount   = ""
+	subject          = ""
+	workDir          = "./work"
+	reportFile       = "./report.csv"
+	verbose          = false
+	apiURL           = ""
+	timeout          = time.Duration(0)
+	qps              = 10.0
+	userRate         = 1000
+)
+
+// ctx is cancelled when the command is interrupted.
+var ctx = context.Background()
+
+// retryPolicy is applied to every Drive call.
+var retryPolicy = gdrive.DefaultRetryPolicy
+
+// retry runs a Drive call with the retry policy until it succeeds or
+// fails permanently. Nothing is called once the command is interrupted.
+func retry(fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return retryPolicy.Do(ctx, fn)
+}
+
+// interrupted reports whether the command was interrupted. Loops stop
+// handing out work when it is.
+func interrupted() bool {
+	return ctx.Err() != nil
+}
+
+// isNotFound reports whether a Drive call failed because the file or
+// permission does not exist.
+func isNotFound(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	return ok && e.Code == http.StatusNotFound
+}
+
+// limiter is shared by all Drive services and workers of a command.
+var limiter *gdrive.RateLimiter
+
+// extraOptions are appended to the service options. Tests use them
+// to talk to a fake Drive server.
+var extraOptions []gdrive.Option
+
+var (
+	errHelp  = errors.New("help requested")
+	errUsage = errors.New("invalid usage")
+
+	// errDiffer is returned when the compared trees differ. The
+	// differences are already printed.
+	errDiffer = errors.New("trees differ")
+)
+
+// partialError is returned by commands which processed everything
+// but failed for some of the items.
+type partialError struct {
+	Failed int
+	Total  int
+}
+
+func (e *partialError) Error() string {
+	return fmt.Sprintf("%d of %d items failed", e.Failed, e.Total)
+}
+
+type command struct {
+	Name  string
+	Args  string // positional arguments shown in usage
+	Short string
+	Run   func(fs *flag.FlagSet, args []string) error
+}
+
+var commands = []*command{
+	{
+		Name:  "share",
+		Args:  "owner@gmail.com [grantee...]",
+		Short: "Share all files owned by an account with users, groups, domains or anyone.",
+		Run:   runShare,
+	},
+	{
+		Name:  "apply",
+		Args:  "manifest.csv|manifest.json",
+		Short: "Set the permissions listed in a manifest, showing the plan first.",
+		Run:   runApply,
+	},
+	{
+		Name:  "rollback",
+		Args:  "journal.jsonl",
+		Short: "Undo the permission changes recorded in a journal.",
+		Run:   runRollback,
+	},
+	{
+		Name:  "unshare",
+		Args:  "owner@gmail.com [grantee]",
+		Short: "Remove the permissions of a grantee from all files owned by an account.",
+		Run:   runUnshare,
+	},
+	{
+		Name:  "prepare",
+		Args:  "account@gmail.com",
+		Short: "Create the destination folder tree and the migration plan.",
+		Run:   runPrepare,
+	},
+	{
+		Name:  "migrate",
+		Args:  "account@gmail.com",
+		Short: "Copy the pending files of the migration plan and write the report.",
+		Run:   runMigrate,
+	},
+	{
+		Name:  "check",
+		Args:  "account@gmail.com",
+		Short: "Verify copied files against the migration plan.",
+		Run:   runCheck,
+	},
+	{
+		Name:  "review",
+		Args:  "",
+		Short: "Summarize the migration plan and filter files out of it.",
+		Run:   runReview,
+	},
+	{
+		Name:  "status",
+		Args:  "",
+		Short: "Show the state of the migration plan.",
+		Run:   runStatus,
+	},
+	{
+		Name:  "compare",
+		Args:  "ID1 ID2",
+		Short: "Compare two folder trees and list the differences.",
+		Run:   runCompare,
+	},
+	{
+		Name:  "audit",
+		Args:  "owner@gmail.com",
+		Short: "Report who can access the files owned by an account.",
+		Run:   runAudit,
+	},
+	{
+		Name:  "cleanup",
+		Args:  "owner@gmail.com",
+		Short: "Remove or restrict sharing outside the allowed domains.",
+		Run:   runCleanup,
+	},
+	{
+		Name:  "transfer",
+		Args:  "from@gmail.com to@gmail.com",
+		Short: "Transfer ownership of files to another account.",
+		Run:   runTransfer,
+	},
+	{
+		Name:  "accounts",
+		Args:  "",
+		Short: "List or remove accounts with stored tokens.",
+		Run:   runAccounts,
+	},
+}
+
+func usage(fs *flag.FlagSet) {
+	fmt.Fprintf(os.Stderr, "Usage: gdriver [global flags] command [flags] [arguments]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.Name, c.Short)
+	}
+	fmt.Fprintf(os.Stderr, "\nGlobal flags:\n")
+	fs.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\nUse \"gdriver command --help\" for more information about a command.\n")
+}
+
+func (c *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: gdriver [global flags] %s [flags] %s\n\n%s\n", c.Name, c.Args, c.Short)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses command flags and checks the number of positional
+// arguments. It returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil, errHelp
+		}
+		return nil, errUsage
+	}
+	if fs.NArg() != n {
+		fs.Usage()
+		return nil, errUsage
+	}
+	return fs.Args(), nil
+}
+
+// parseArgsMin is parseArgs for commands taking at least n positional
+// arguments.
+func parseArgsMin(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil, errHelp
+		}
+		return nil, errUsage
+	}
+	if fs.NArg() < n {
+		fs.Usage()
+		return nil, errUsage
+	}
+	return fs.Args(), nil
+}
+
+// debugf prints only when --verbose is set.
+func debugf(format string, a ...interface{}) {
+	if verbose {
+		fmt.Printf(format, a...)
+	}
+}
+
+// newService returns an authorized Drive client configured by the global flags.
+func newService() (*drive.Service, error) {
+	opts := []gdrive.Option{
+		gdrive.WithClientSecret(clientSecretFile, gdrive.NewTokenStore(tokenDir), account),
+		gdrive.WithWebFlow(&gdrive.WebFlow{Headless: headless}),
+		gdrive.WithTimeout(timeout),
+		gdrive.WithRateLimiter(limiter),
+	}
+	if serviceAccount != "" {
+		opts = append(opts, gdrive.WithServiceAccount(serviceAccount, subject))
+	}
+	if apiURL != "" {
+		opts = append(opts, gdrive.WithBasePath(apiURL))
+	}
+	opts = append(opts, extraOptions...)
+
+	srv, err := gdrive.NewService(ctx, opts...)
+	switch e := err.(type) {
+	case *gdrive.RefreshError:
+		return nil, fmt.Errorf("%v\nLog in again after gdriver accounts --remove %s", err, e.Account)
+	case *gdrive.CorruptTokenError:
+		return nil, fmt.Errorf("%v\nLog in again after gdriver accounts --remove %s", err, e.Account)
+	}
+	return srv, err
+}
+
+// run executes the command line and returns the exit code.
+func run(args []string) int {
+	fs := flag.NewFlagSet("gdriver", flag.ContinueOnError)
+	fs.Usage = func() { usage(fs) }
+	fs.StringVar(&clientSecretFile, "client-secret", clientSecretFile, "OAuth client secret `file`")
+	fs.StringVar(&tokenDir, "token-dir", tokenDir, "`directory` of stored OAuth tokens")
+	fs.StringVar(&account, "account", account, "stored `email` to act as (default the only stored account)")
+	fs.BoolVar(&headless, "headless", headless, "log in without opening a browser, e.g. over SSH")
+	fs.StringVar(&serviceAccount, "service-account", serviceAccount, "service account JSON key `file`, used instead of the client secret")
+	fs.StringVar(&subject, "subject", subject, "`email` of the domain user the service account impersonates")
+	fs.StringVar(&workDir, "workdir", workDir, "migration working `directory`")
+	fs.StringVar(&reportFile, "report", reportFile, "migration report CSV `file`")
+	fs.BoolVar(&verbose, "verbose", verbose, "print detailed progress")
+	fs.StringVar(&apiURL, "api-url", apiURL, "Drive API base `URL` (default production Google)")
+	fs.DurationVar(&timeout, "timeout", timeout, "timeout of a single Drive request (0 means none)")
+	fs.Float64Var(&qps, "qps", qps, "maximum Drive requests per second (0 means unlimited)")
+	fs.IntVar(&userRate, "user-rate", userRate, "maximum Drive requests per user in 100 seconds (0 means unlimited)")
+	fs.DurationVar(&retryPolicy.MaxElapsedTime, "max-retry-time", retryPolicy.MaxElapsedTime, "give up retrying a failing Drive request after this time")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() < 1 {
+		usage(fs)
+		return exitUsage
+	}
+
+	retryPolicy.Notify = func(err error, wait time.Duration) {
+		debugf("Retrying in %s: %v\n", wait, err)
+	}
+
+	limiter = gdrive.NewRateLimiter(qps, userRate)
+	limiter.Notify = func(rate float64) {
+		debugf("Rate limit exceeded, slowing down to %.1f requests/s\n", rate)
+	}
+
+	c, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		ctx = context.Background()
+	}()
+	ctx = c
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			// A second Ctrl+C kills the command
+			signal.Reset(os.Interrupt)
+			fmt.Fprintf(os.Stderr, "\nInterrupted, finishing the requests in flight. Press Ctrl+C again to quit now.\n")
+			cancel()
+		case <-c.Done():
+		}
+	}()
+
+	name := fs.Arg(0)
+	for _, c := range commands {
+		if c.Name != name {
+			continue
+		}
+		err := c.Run(c.flagSet(), fs.Args()[1:])
+		if interrupted() {
+			log.Print("Interrupted")
+			return exitInterrupted
+		}
+		switch err.(type) {
+		case nil:
+			return exitOK
+		case *partialError:
+			log.Print(err.Error())
+			return exitPartial
+		}
+		switch err {
+		case errHelp:
+			return exitOK
+		case errUsage:
+			return exitUsage
+		case errDiffer:
+			return exitDiffer
+		}
+		log.Print(err.Error())
+		return exitFailure
+	}
+
+	fmt.Fprintf(os.Stderr, "gdriver: unknown command %q\n\n", name)
+	usage(fs)
+	return exitUsage
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
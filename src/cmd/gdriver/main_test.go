@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"gdrive"
+	"gdrive/fakedrive"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/api/drive/v2"
+)
+
+const (
+	userA = "a@example.com"
+	userB = "b@example.com"
+)
+
+// setup starts a fake Drive server and changes to a temporary
+// directory holding the work directory, the report and journals. Call
+// the returned function when done.
+func setup(t *testing.T) (*fakedrive.Server, func()) {
+	dir, err := ioutil.TempDir("", "gdriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	workDir = filepath.Join(dir, "work")
+	reportFile = filepath.Join(dir, "report.csv")
+	qps, userRate = 1000, 0
+	retryPolicy = gdrive.RetryPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     10 * time.Millisecond,
+		Multiplier:      2,
+		MaxElapsedTime:  100 * time.Millisecond,
+	}
+
+	s := fakedrive.NewServer()
+	return s, func() {
+		s.Close()
+		extraOptions = nil
+		retryPolicy = gdrive.DefaultRetryPolicy
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+// gdriver runs the command line as user and returns the exit code.
+func gdriver(s *fakedrive.Server, user string, args ...string) int {
+	extraOptions = s.Options(user)
+	return run(args)
+}
+
+// fixture creates a small tree owned by userA and shared with userB:
+//
+//	Projects/readme.txt
+//	Projects/ACME/spec.txt
+//	Projects/ACME/Docs/
+func fixture(s *fakedrive.Server) (projects, acme string) {
+	p := s.AddFolder(userA, "Projects", "")
+	a := s.AddFolder(userA, "ACME", p.Id)
+	s.AddFolder(userA, "Docs", a.Id)
+	s.AddFile(userA, "readme.txt", p.Id, "read me")
+	s.AddFile(userA, "spec.txt", a.Id, "the spec")
+
+	for _, f := range s.Files(userA) {
+		s.Share(f.Id, userB, "reader")
+	}
+	return p.Id, a.Id
+}
+
+// migrated runs prepare and migrate as userB.
+func migrated(t *testing.T, s *fakedrive.Server) {
+	if code := gdriver(s, userB, "prepare", userA); code != exitOK {
+		t.Fatalf("prepare exit code %d", code)
+	}
+	if code := gdriver(s, userB, "migrate", userA); code != exitOK {
+		t.Fatalf("migrate exit code %d", code)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{nil, exitUsage},
+		{[]string{"nosuchcommand"}, exitUsage},
+		{[]string{"share", "--help"}, exitOK},
+		{[]string{"share", userA}, exitUsage},
+		{[]string{"--nosuchflag", "share"}, exitUsage},
+	} {
+		if code := run(tt.args); code != tt.code {
+			t.Errorf("%v: exit code %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
+
+// byTitle returns the files with the given title.
+func byTitle(files []*drive.File, title string) []*drive.File {
+	var r []*drive.File
+	for _, f := range files {
+		if f.Title == title {
+			r = append(r, f)
+		}
+	}
+	return r
+}
+
+func TestInterrupt(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	for i := 0; i < 40; i++ {
+		s.AddFile(userA, fmt.Sprintf("f%d.txt", i), "", "f")
+	}
+	s.AddFault(fakedrive.Fault{Op: "drive.permissions.insert", Delay: 20 * time.Millisecond})
+
+	// Ctrl+C once the first permission is being inserted
+	go func() {
+		for s.Calls("drive.permissions.insert") == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		p, err := os.FindProcess(os.Getpid())
+		if err == nil {
+			err = p.Signal(os.Interrupt)
+		}
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	if code := gdriver(s, userA, "share", "--workers", "2", userA, userB); code != exitInterrupted {
+		t.Fatalf("exit code %d, want %d", code, exitInterrupted)
+	}
+	if n := s.Calls("drive.permissions.insert"); n >= 40 {
+		t.Errorf("%d permissions inserted after the interrupt, want fewer than 40", n)
+	}
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// Outcomes of manifest rows besides those of share
+const (
+	shareDowngraded = "downgraded"
+	shareRemoved    = "removed"
+)
+
+// manifestRow is a permission a manifest asks for. Role "none" or a
+// past expiry ask for the permission to be removed.
+type manifestRow struct {
+	Line     int
+	Target   string // /path/in/My Drive or file ID
+	Grantee  string
+	Role     string
+	Type     string
+	WithLink bool // only people with the link, for domain and anyone
+	Expiry   time.Time
+}
+
+// newManifestRow returns the row of the line with the fields as read.
+func newManifestRow(line int, target, grantee, role, typ string, withLink bool, expiry string) (*manifestRow, error) {
+	r := &manifestRow{Line: line, Target: target, Grantee: grantee, Role: role, Type: typ, WithLink: withLink}
+	if expiry != "" {
+		var d dateFlag
+		if err := d.Set(expiry); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		r.Expiry = d.Time
+	}
+	return r, nil
+}
+
+// expired reports whether the permission should be gone by now.
+func (r *manifestRow) expired(now time.Time) bool {
+	return !r.Expiry.IsZero() && !now.Before(r.Expiry)
+}
+
+func (r *manifestRow) validate() error {
+	if r.Type == "" {
+		r.Type = "user"
+	}
+	switch r.Role {
+	case "reader", "commenter", "writer", "none":
+	default:
+		return fmt.Errorf("line %d: unknown role %q", r.Line, r.Role)
+	}
+	switch r.Type {
+	case "user", "group", "domain":
+		if r.Grantee == "" {
+			return fmt.Errorf("line %d: no grantee", r.Line)
+		}
+	case "anyone":
+	default:
+		return fmt.Errorf("line %d: unknown grantee type %q", r.Line, r.Type)
+	}
+	if r.WithLink && r.Type != "domain" && r.Type != "anyone" {
+		return fmt.Errorf("line %d: withLink applies only to types domain and anyone", r.Line)
+	}
+	if r.Target == "" {
+		return fmt.Errorf("line %d: no target", r.Line)
+	}
+	return nil
+}
+
+// readManifest reads a JSON manifest, an array of objects, or a CSV
+// one with the header target,grantee,role[,type][,withLink][,expiry].
+// The target column may also be called path.
+func readManifest(name string) ([]*manifestRow, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows []*manifestRow
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		rows, err = readManifestJSON(f)
+	} else {
+		rows, err = readManifestCSV(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	for _, r := range rows {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return rows, nil
+}
+
+func readManifestJSON(r io.Reader) ([]*manifestRow, error) {
+	var items []struct {
+		Target   string `json:"target"`
+		Path     string `json:"path"`
+		Grantee  string `json:"grantee"`
+		Role     string `json:"role"`
+		Type     string `json:"type"`
+		WithLink bool   `json:"withLink"`
+		Expiry   string `json:"expiry"`
+	}
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, err
+	}
+
+	var rows []*manifestRow
+	for i, it := range items {
+		if it.Target == "" {
+			it.Target = it.Path
+		}
+		row, err := newManifestRow(i+1, it.Target, it.Grantee, it.Role, it.Type, it.WithLink, it.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func readManifestCSV(r io.Reader) ([]*manifestRow, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{}
+	for i, c := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(c))] = i
+	}
+	if _, ok := columns["target"]; !ok {
+		if i, ok := columns["path"]; ok {
+			columns["target"] = i
+		}
+	}
+	for _, c := range []string{"target", "grantee", "role"} {
+		if _, ok := columns[c]; !ok {
+			return nil, fmt.Errorf("missing column %s", c)
+		}
+	}
+	get := func(record []string, c string) string {
+		i, ok := columns[c]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []*manifestRow
+	for n, record := range records[1:] {
+		withLink := false
+		if v := get(record, "withlink"); v != "" {
+			if withLink, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("line %d: invalid withLink %q", n+2, v)
+			}
+		}
+		row, err := newManifestRow(n+2, get(record, "target"), get(record, "grantee"),
+			get(record, "role"), get(record, "type"), withLink, get(record, "expiry"))
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// step is the change planned for a manifest row.
+type step struct {
+	Row      *manifestRow
+	File     *drive.File
+	Perms    []*drive.Permission
+	Grantee  grantee
+	Existing *drive.Permission
+	Action   string // one of the share outcomes
+	Entry    *journalEntry
+	Err      error
+}
+
+// resolver finds files by path or ID and caches what it has seen.
+type resolver struct {
+	srv   *drive.Service
+	files map[string]*drive.File         // path or ID -> file
+	perms map[string][]*drive.Permission // file ID -> permissions
+	gs    map[string]grantee             // type:value:withLink -> grantee
+}
+
+func newResolver(srv *drive.Service) *resolver {
+	return &resolver{
+		srv:   srv,
+		files: map[string]*drive.File{},
+		perms: map[string][]*drive.Permission{},
+		gs:    map[string]grantee{},
+	}
+}
+
+// quote returns the string as a Drive query literal.
+func quote(s string) string {
+	return "'" + strings.Replace(strings.Replace(s, `\`, `\\`, -1), "'", `\'`, -1) + "'"
+}
+
+// file returns the file of a path starting at My Drive or of an ID.
+func (r *resolver) file(target string) (*drive.File, error) {
+	if f, ok := r.files[target]; ok {
+		return f, nil
+	}
+
+	var f *drive.File
+	if !strings.HasPrefix(target, "/") {
+		err := retry(func() (err error) {
+			f, err = r.srv.Files.Get(target).Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		r.files[target] = f
+		return f, nil
+	}
+
+	dir, title := path.Split(strings.TrimSuffix(target, "/"))
+	if title == "" {
+		err := retry(func() (err error) {
+			f, err = r.srv.Files.Get("root").Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		r.files[target] = f
+		return f, nil
+	}
+
+	// Resolve the parent first
+	parent, err := r.file(path.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := listFiles(r.srv, quote(parent.Id)+" in parents and title = "+quote(title)+" and trashed = false")
+	if err != nil {
+		return nil, err
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("%s not found", target)
+	case 1:
+		r.files[target] = found[0]
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("%s is ambiguous, %d items have the title, use an ID", target, len(found))
+}
+
+func (r *resolver) permissions(f *drive.File) ([]*drive.Permission, error) {
+	if perms, ok := r.perms[f.Id]; ok {
+		return perms, nil
+	}
+	perms, err := filePermissions(r.srv, f)
+	if err != nil {
+		return nil, err
+	}
+	r.perms[f.Id] = perms
+	return perms, nil
+}
+
+func (r *resolver) grantee(typ, value string, withLink bool) (grantee, error) {
+	key := fmt.Sprintf("%s:%s:%t", typ, value, withLink)
+	if g, ok := r.gs[key]; ok {
+		return g, nil
+	}
+	gs, err := lookupGrantees(r.srv, []string{value}, &shareOptions{Type: typ, WithLink: withLink})
+	if err != nil {
+		return grantee{}, err
+	}
+	r.gs[key] = gs[0]
+	return gs[0], nil
+}
+
+// plan compares the manifest with the current permissions.
+func plan(srv *drive.Service, rows []*manifestRow, now time.Time) []*step {
+	r := newResolver(srv)
+	var steps []*step
+	for _, row := range rows {
+		if interrupted() {
+			break
+		}
+		s := &step{Row: row}
+		steps = append(steps, s)
+
+		if s.File, s.Err = r.file(row.Target); s.Err != nil {
+			continue
+		}
+		if s.Perms, s.Err = r.permissions(s.File); s.Err != nil {
+			continue
+		}
+		if s.Grantee, s.Err = r.grantee(row.Type, row.Grantee, row.WithLink); s.Err != nil {
+			continue
+		}
+		for _, p := range s.Perms {
+			if s.Grantee.Match(p) {
+				s.Existing = p
+				break
+			}
+		}
+
+		want := &drive.Permission{}
+		remove := row.Role == "none" || row.expired(now)
+		if !remove {
+			want = (&shareOptions{Role: row.Role}).permission("")
+		}
+		switch {
+		case s.Existing != nil && s.Existing.Role == "owner":
+			s.Err = fmt.Errorf("%s owns %s", row.Grantee, row.Target)
+		case remove && s.Existing == nil:
+			s.Action = shareSkipped
+		case remove:
+			s.Action = shareRemoved
+		case s.Existing == nil:
+			s.Action = shareInserted
+		case roleRank(s.Existing) == roleRank(want):
+			s.Action = shareSkipped
+		case roleRank(s.Existing) < roleRank(want):
+			s.Action = shareUpgraded
+		default:
+			s.Action = shareDowngraded
+		}
+	}
+	return steps
+}
+
+// describe returns a line of the plan or of the report.
+func (s *step) describe() string {
+	r := s.Row
+	who := r.Grantee
+	if r.Type != "user" {
+		who = strings.TrimSpace(r.Type + " " + r.Grantee)
+	}
+	if r.WithLink {
+		who += " with link"
+	}
+	if s.Err != nil {
+		return fmt.Sprintf("line %d: %s %s: failed: %v", r.Line, r.Target, who, s.Err)
+	}
+	from := ""
+	if s.Existing != nil {
+		from = roleName(s.Existing) + " -> "
+	}
+	to := r.Role
+	if s.Action == shareRemoved || s.Action == shareSkipped && r.Role == "none" {
+		to = "none"
+	}
+	return fmt.Sprintf("line %d: %s %s: %s (%s%s)", r.Line, r.Target, who, s.Action, from, to)
+}
+
+// apply carries out a planned step and records it in the journal.
+func (s *step) apply(srv *drive.Service, j *journal) {
+	r := s.Row
+	switch s.Action {
+	case shareInserted, shareUpgraded:
+		o := &shareOptions{Role: r.Role, Type: r.Type, WithLink: r.WithLink}
+		s.Entry, s.Err = shareFile(srv, s.File, s.Perms, s.Grantee, o)
+	case shareDowngraded:
+		p := rolePermission(&drive.Permission{}, r.Role)
+		s.Err = retry(func() error {
+			_, err := srv.Permissions.Patch(s.File.Id, s.Existing.Id, p).Context(ctx).Do()
+			return err
+		})
+		s.Entry = s.entry(r.Role)
+	case shareRemoved:
+		s.Err = retry(func() error {
+			return srv.Permissions.Delete(s.File.Id, s.Existing.Id).Context(ctx).Do()
+		})
+		s.Entry = s.entry("")
+	default:
+		return
+	}
+
+	if s.Err != nil {
+		s.Entry.Outcome = shareFailed
+		s.Entry.Error = s.Err.Error()
+	}
+	if err := j.Write(s.Entry); err != nil && s.Err == nil {
+		s.Err = err
+	}
+}
+
+func (s *step) entry(role string) *journalEntry {
+	return &journalEntry{
+		FileID:       s.File.Id,
+		Title:        s.File.Title,
+		PermissionID: s.Existing.Id,
+		Type:         s.Existing.Type,
+		Value:        permissionValue(s.Existing),
+		WithLink:     s.Existing.WithLink,
+		PreviousRole: roleName(s.Existing),
+		Role:         role,
+		Outcome:      s.Action,
+	}
+}
+
+// permissionValue returns the value to insert the permission again.
+func permissionValue(p *drive.Permission) string {
+	if p.Type == "domain" {
+		return p.Domain
+	}
+	return p.EmailAddress
+}
+
+func applyManifest(srv *drive.Service, rows []*manifestRow, dryRun bool, workers int, j *journal) error {
+	steps := plan(srv, rows, time.Now())
+	if interrupted() {
+		return ctx.Err()
+	}
+
+	fmt.Printf("Plan:\n")
+	for _, s := range steps {
+		fmt.Printf("  %s\n", s.describe())
+	}
+	if dryRun {
+		return nil
+	}
+
+	// Rows of the same file change its permissions, so they are
+	// applied by the same worker in manifest order.
+	byFile := map[string][]*step{}
+	var order []string
+	for _, s := range steps {
+		if s.Err != nil || s.Action == shareSkipped {
+			continue
+		}
+		if _, ok := byFile[s.File.Id]; !ok {
+			order = append(order, s.File.Id)
+		}
+		byFile[s.File.Id] = append(byFile[s.File.Id], s)
+	}
+
+	queue := make(chan []*step)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range queue {
+				for _, s := range group {
+					s.apply(srv, j)
+				}
+			}
+		}()
+	}
+	for _, id := range order {
+		if interrupted() {
+			break
+		}
+		queue <- byFile[id]
+	}
+	close(queue)
+	wg.Wait()
+
+	fmt.Printf("Result:\n")
+	failed := 0
+	for _, s := range steps {
+		fmt.Printf("  %s\n", s.describe())
+		if s.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return &partialError{Failed: failed, Total: len(steps)}
+	}
+	return nil
+}
+
+func runApply(fs *flag.FlagSet, args []string) error {
+	dryRun := fs.Bool("dry-run", false, "only show the plan")
+	workers := fs.Int("workers", 5, "`number` of files changed in parallel")
+	journalFile := fs.String("journal", defaultJournal("apply"), "journal `file` the changes are appended to, for rollback")
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *workers < 1 {
+		fmt.Fprintf(os.Stderr, "--workers must be at least 1\n\n")
+		fs.Usage()
+		return errUsage
+	}
+
+	rows, err := readManifest(args[0])
+	if err != nil {
+		return err
+	}
+
+	srv, err := newService()
+	if err != nil {
+		return err
+	}
+
+	var j *journal
+	if !*dryRun {
+		if j, err = openJournal(*journalFile); err != nil {
+			return err
+		}
+		defer j.Close()
+		log.Printf("Journal: %s", *journalFile)
+	}
+
+	return applyManifest(srv, rows, *dryRun, *workers, j)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestApplyManifest(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	spec := byTitle(s.Files(userA), "spec.txt")[0]
+
+	manifest := "target,grantee,role,type,expiry\n" +
+		"/Projects/ACME,c@example.com,writer,,\n" +
+		"/Projects/readme.txt," + userB + ",none,,\n" +
+		spec.Id + "," + userB + ",commenter,,\n" +
+		"/Projects/ACME/Docs," + userB + ",reader,,2015-01-01\n" +
+		"/Projects/ACME," + userB + ",reader,,\n" +
+		"/Projects/Missing,c@example.com,reader,,\n"
+	if err := ioutil.WriteFile("manifest.csv", []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := gdriver(s, userA, "apply", "--dry-run", "manifest.csv"); code != exitOK {
+		t.Fatalf("dry run exit code %d", code)
+	}
+	if n := s.Calls("drive.permissions.insert") + s.Calls("drive.permissions.patch") + s.Calls("drive.permissions.delete"); n != 0 {
+		t.Fatalf("dry run made %d changes", n)
+	}
+
+	if code := gdriver(s, userA, "apply", "--journal", "apply.jsonl", "manifest.csv"); code != exitPartial {
+		t.Fatalf("exit code %d, want %d", code, exitPartial)
+	}
+
+	roles := func(title string) map[string]string {
+		f := byTitle(s.Files(userA), title)[0]
+		m := map[string]string{}
+		for _, p := range f.Permissions {
+			m[p.EmailAddress] = roleName(p)
+		}
+		return m
+	}
+	for _, tt := range []struct{ title, email, want string }{
+		{"ACME", "c@example.com", "writer"},
+		{"ACME", userB, "reader"},
+		{"readme.txt", userB, ""},
+		{"spec.txt", userB, "commenter"},
+		{"Docs", userB, ""},
+	} {
+		if got := roles(tt.title)[tt.email]; got != tt.want {
+			t.Errorf("%s: %s is %q, want %q", tt.title, tt.email, got, tt.want)
+		}
+	}
+	if n := s.Calls("drive.permissions.insert"); n != 1 {
+		t.Errorf("%d permissions inserted, want 1", n)
+	}
+
+	if code := gdriver(s, userA, "rollback", "apply.jsonl"); code != exitOK {
+		t.Fatalf("rollback exit code %d", code)
+	}
+	for _, title := range []string{"ACME", "readme.txt", "spec.txt", "Docs"} {
+		r := roles(title)
+		if r[userB] != "reader" || r["c@example.com"] != "" {
+			t.Errorf("%s after rollback: %v", title, r)
+		}
+	}
+}
+
+func TestApplyManifestJSON(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+
+	manifest := `[{"path": "/Projects", "grantee": "team@example.com", "type": "group", "role": "reader"}]`
+	if err := ioutil.WriteFile("manifest.json", []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code := gdriver(s, userA, "apply", "manifest.json"); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	if _, ok := grantees(byTitle(s.Files(userA), "Projects")[0])["team@example.com"]; !ok {
+		t.Error("Projects not shared with the group")
+	}
+
+	if err := ioutil.WriteFile("bad.json", []byte(`[{"path": "/Projects", "grantee": "x", "role": "owner"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code := gdriver(s, userA, "apply", "bad.json"); code != exitFailure {
+		t.Errorf("invalid role: exit code %d, want %d", code, exitFailure)
+	}
+}
+
+func TestApplyManifestWithLink(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	if code := gdriver(s, userA, "share", "--type", "anyone", "--with-link", userA); code != exitOK {
+		t.Fatalf("share exit code %d", code)
+	}
+
+	manifest := "target,grantee,role,type,withLink\n" +
+		"/Projects,,none,anyone,\n" +
+		"/Projects/readme.txt,,none,anyone,true\n"
+	if err := ioutil.WriteFile("manifest.csv", []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code := gdriver(s, userA, "apply", "manifest.csv"); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	linked := func(title string) bool {
+		for _, p := range byTitle(s.Files(userA), title)[0].Permissions {
+			if p.Type == "anyone" && p.WithLink {
+				return true
+			}
+		}
+		return false
+	}
+	if !linked("Projects") {
+		t.Error("link sharing of Projects removed by a row without withLink")
+	}
+	if linked("readme.txt") {
+		t.Error("link sharing of readme.txt not removed")
+	}
+
+	if err := ioutil.WriteFile("bad.csv", []byte("target,grantee,role,withLink\n/Projects,"+userB+",reader,true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code := gdriver(s, userA, "apply", "bad.csv"); code != exitFailure {
+		t.Errorf("withLink of a user: exit code %d, want %d", code, exitFailure)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"util"
+
+	"github.com/cheggaaa/pb"
+
+	"google.golang.org/api/drive/v2"
+)
+
+type result struct {
+	Item *planItem
+	Dest *drive.File
+	Err  error
+}
+
+var Report *csv.Writer
+var reportMu sync.Mutex
+
+// openReport creates the report file and writes its header.
+func openReport() (*os.File, error) {
+	f, err := os.OpenFile(reportFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	Report = csv.NewWriter(f)
+
+	record := []string{
+		"S:Title",
+		"S:Id",
+		"S:MD5",
+		"S:Size",
+		"D:Title",
+		"D:Id",
+		"D:MD5",
+		"D:Size",
+	}
+	if err := Report.Write(record); err != nil {
+		fmt.Printf("\nERROR writing report: %s \n", err.Error())
+	}
+	return f, nil
+}
+
+// sourceProperty is the private property of copies and of the folders
+// created by prepare which holds the ID of their source file.
+const sourceProperty = "gdriverSource"
+
+// findCopy returns the copy of the source file made before, or nil.
+func findCopy(srv *drive.Service, sourceID string) (*drive.File, error) {
+	found, err := listFiles(srv, propertyQuery(sourceProperty, sourceID))
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	if len(found) > 1 {
+		fmt.Printf("\n%d copies of %s, using %s\n", len(found), sourceID, found[0].Id)
+	}
+	return found[0], nil
+}
+
+// migrateFile copies the file, unless it was copied before. started is
+// set when an earlier run may have made the copy.
+func migrateFile(srv *drive.Service, t *planItem, started bool) (*drive.File, error) {
+
+	var sourceFile *drive.File
+	err := retry(func() (err error) {
+		sourceFile, err = srv.Files.Get(t.SourceID).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		fmt.Printf("\nFiles.Get ERROR\n")
+		return nil, err
+	}
+
+	if !sourceFile.Copyable {
+		return nil, fmt.Errorf("%s (%s) is not copyable", sourceFile.Title, t.SourceID)
+	}
+
+	// Construct target
+	targetFile := drive.File{Title: sourceFile.Title}
+	targetFile.Parents = []*drive.ParentReference{}
+
+	for _, p := range t.Parents {
+		targetFile.Parents = append(
+			targetFile.Parents,
+			&drive.ParentReference{Id: p})
+	}
+
+	targetFile.Properties = []*drive.Property{
+		{Key: sourceProperty, Value: t.SourceID, Visibility: "PRIVATE"},
+	}
+
+	// Copy file, or find the copy of an interrupted run
+	var resultFile *drive.File
+	if t.DestID != "" {
+		// Copied before, removing its permissions failed
+		err = retry(func() (err error) {
+			resultFile, err = srv.Files.Get(t.DestID).Context(ctx).Do()
+			return err
+		})
+	} else if started {
+		if resultFile, err = findCopy(srv, t.SourceID); err != nil {
+			return nil, err
+		}
+		if resultFile != nil {
+			debugf("Found copy %s of %s\n", resultFile.Id, t.SourceID)
+		}
+	}
+	if resultFile == nil && err == nil {
+		attempt := 0
+		err = retry(func() (err error) {
+			// A failed request may have made the copy anyway
+			if attempt++; attempt > 1 {
+				if resultFile, err = findCopy(srv, t.SourceID); err != nil || resultFile != nil {
+					return err
+				}
+			}
+			resultFile, err = srv.Files.Copy(t.SourceID, &targetFile).Context(ctx).Do()
+			return err
+		})
+	}
+	if err != nil {
+		for _, p := range t.Parents {
+			e := retry(func() error {
+				_, err := srv.Files.Get(p).Context(ctx).Do()
+				return err
+			})
+			if e != nil {
+				fmt.Printf("\n###### PARENT ERROR\n")
+			}
+		}
+
+		return nil, err
+	}
+
+	// Remove all permissions
+	perms, err := filePermissions(srv, resultFile)
+	if err != nil {
+		return resultFile, err
+	}
+	for _, p := range perms {
+		var permission *drive.Permission
+		err := retry(func() (err error) {
+			permission, err = srv.Permissions.Get(resultFile.Id, p.Id).Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			fmt.Printf("\n\nERROR 101\n\n")
+			return resultFile, err
+		}
+		if permission.Role != "owner" {
+			err := retry(func() error {
+				return srv.Permissions.Delete(resultFile.Id, p.Id).Context(ctx).Do()
+			})
+			if err != nil {
+				fmt.Printf("\n\nERROR 102\n\n")
+				return resultFile, err
+			}
+		}
+	}
+
+	record := []string{
+		sourceFile.Title,
+		sourceFile.Id,
+		sourceFile.Md5Checksum,
+		fmt.Sprintf("%d", sourceFile.FileSize),
+		resultFile.Title,
+		resultFile.Id,
+		resultFile.Md5Checksum,
+		fmt.Sprintf("%d", resultFile.QuotaBytesUsed),
+	}
+	reportMu.Lock()
+	defer reportMu.Unlock()
+	if err := Report.Write(record); err != nil {
+		fmt.Printf("\nERROR writing report: %s \n", err.Error())
+	}
+
+	return resultFile, nil
+}
+
+func worker(id int, srv *drive.Service, mp *migrationPlan, intents *intentLog, started map[string]bool, tasks <-chan *planItem, results chan<- result) {
+	for t := range tasks {
+		if interrupted() {
+			continue // drain the queue
+		}
+		debugf("Worker %d processing job %s\n", id, t.SourceID)
+
+		// Record the intent before copying
+		maybeCopied := started[t.SourceID] || t.State == stateCopying
+		err := intents.Record(t.SourceID)
+		if err == nil {
+			err = mp.Update(t, func(item *planItem) { item.State = stateCopying })
+		}
+		if err != nil {
+			results <- result{Item: t, Err: err}
+			continue
+		}
+
+		dest, err := migrateFile(srv, t, maybeCopied)
+		if err != nil {
+			fmt.Printf("\n==> ERROR: %s\n", err.Error())
+		}
+		results <- result{Item: t, Dest: dest, Err: err}
+	}
+}
+
+func migrate(srv *drive.Service, accountFrom string) error {
+	mp, err := readMigrationPlan()
+	if err != nil {
+		return err
+	}
+	if mp.Root == "" {
+		return fmt.Errorf("The migration plan has no destination folders yet.\nUse gdriver prepare --from-plan %s", accountFrom)
+	}
+
+	rf, err := openReport()
+	if err != nil {
+		return err
+	}
+	defer rf.Close()
+
+	intents, started, err := openIntentLog()
+	if err != nil {
+		return err
+	}
+	defer intents.Close()
+
+	// Pending files, files which failed or stopped copying and copies
+	// whose permissions are left
+	var tasks []*planItem
+	files := mp.Files()
+	for _, item := range files {
+		if item.State == statePending || item.State == stateCopying || item.State == stateFailed && (item.DestID == "" || item.Shared) {
+			tasks = append(tasks, item)
+		}
+	}
+	fmt.Printf("Migrating %d of %d files\n", len(tasks), len(files))
+
+	queue := make(chan *planItem, 1000)
+	results := make(chan result, 100)
+
+	// Start some workers
+	var wg sync.WaitGroup
+	for w := 1; w <= 5; w++ {
+		fmt.Printf("Starting worker %d\n", w)
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			worker(w, srv, mp, intents, started, queue, results)
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Send tasks to queue
+	go func() {
+		for _, t := range tasks {
+			if interrupted() {
+				break
+			}
+			queue <- t
+			debugf("Sent job %s\n", t.SourceID)
+		}
+		close(queue)
+		fmt.Printf("Sent all jobs\n")
+	}()
+
+	// Progress bar
+	bar := pb.New(len(tasks))
+	bar.SetRefreshRate(time.Second)
+	bar.Start()
+
+	// Receive results
+	failed := 0
+	var saveErr error
+	for r := range results {
+		bar.Increment()
+		if r.Err != nil && r.Dest == nil && interrupted() {
+			// Left copying, the copy is looked up on resume
+			continue
+		}
+		err := mp.Update(r.Item, func(item *planItem) {
+			if r.Dest != nil {
+				item.DestID = r.Dest.Id
+			}
+			item.Shared = r.Dest != nil && r.Err != nil
+			if r.Err != nil {
+				item.State = stateFailed
+				item.Error = r.Err.Error()
+				return
+			}
+			item.State = stateCopied
+			item.Error = ""
+		})
+		if err != nil && saveErr == nil {
+			saveErr = err
+		}
+		if r.Err == nil {
+			debugf("SUCCESS job %s (%.1f requests/s)\n", r.Item.SourceID, limiter.Throughput())
+		} else {
+			fmt.Printf("FAILURE job %s\n", r.Item.SourceID)
+			failed++
+		}
+	}
+
+	bar.FinishPrint("Done.")
+	fmt.Printf("Throughput: %.1f requests/s\n", limiter.Throughput())
+
+	Report.Flush()
+
+	if err := mp.Save(); err != nil {
+		return err
+	}
+	if saveErr != nil {
+		return saveErr
+	}
+	if failed > 0 {
+		return &partialError{Failed: failed, Total: len(tasks)}
+	}
+
+	// Everything is OK
+	return nil
+}
+
+func runMigrate(fs *flag.FlagSet, args []string) error {
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	accountFrom := args[0]
+
+	workExists, err := util.FileExists(workDir)
+	if err != nil {
+		return err
+	}
+	if !workExists {
+		return fmt.Errorf("Working directory %s does not exist.\nUse gdriver prepare to create one", workDir)
+	}
+
+	srv, err := newService()
+	if err != nil {
+		return err
+	}
+
+	return migrate(srv, accountFrom)
+}
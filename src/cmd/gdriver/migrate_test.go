@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/csv"
+	"gdrive/fakedrive"
+	"os"
+	"testing"
+
+	"google.golang.org/api/drive/v2"
+)
+
+func TestMigrate(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	migrated(t, s)
+
+	files := s.Files(userB)
+	for _, src := range []string{"readme.txt", "spec.txt"} {
+		copies := byTitle(files, src)
+		if len(copies) != 1 {
+			t.Errorf("%d copies of %s, want 1", len(copies), src)
+			continue
+		}
+		orig := byTitle(s.Files(userA), src)[0]
+		if copies[0].Md5Checksum != orig.Md5Checksum {
+			t.Errorf("%s: MD5 %s, want %s", src, copies[0].Md5Checksum, orig.Md5Checksum)
+		}
+	}
+	spec := byTitle(files, "spec.txt")[0]
+	if acme := byTitle(files, "ACME")[0]; spec.Parents[0].Id != acme.Id {
+		t.Errorf("spec.txt copied to %s, want ACME (%s)", spec.Parents[0].Id, acme.Id)
+	}
+
+	mp, err := readMigrationPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range mp.Files() {
+		if item.State != stateCopied || item.DestID == "" {
+			t.Errorf("%s is %s (%q) after migrate", item.Path, item.State, item.DestID)
+		}
+	}
+
+	f, err := os.Open(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Errorf("%d report lines, want header and 2 files", len(records))
+	}
+}
+
+func TestMigrateWithoutWorkDir(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+
+	if code := gdriver(s, userB, "migrate", userA); code != exitFailure {
+		t.Fatalf("exit code %d, want %d", code, exitFailure)
+	}
+}
+
+func TestMigrateResume(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	if code := gdriver(s, userB, "prepare", userA); code != exitOK {
+		t.Fatalf("prepare exit code %d", code)
+	}
+
+	// A crashed run copied both files. The plan recorded the intent to
+	// copy readme.txt, only the intent log the one of spec.txt.
+	srv, err := s.Service(userB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp, err := readMigrationPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	intents, _, err := openIntentLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	made := map[string]string{}
+	for _, item := range mp.Files() {
+		c, err := srv.Files.Copy(item.SourceID, &drive.File{
+			Title:      item.Title,
+			Parents:    []*drive.ParentReference{{Id: item.Parents[0]}},
+			Properties: []*drive.Property{{Key: sourceProperty, Value: item.SourceID, Visibility: "PRIVATE"}},
+		}).Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+		made[item.SourceID] = c.Id
+		if item.Title == "readme.txt" {
+			item.State = stateCopying
+		} else if err := intents.Record(item.SourceID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	intents.Close()
+	if err := mp.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	copies := s.Calls("drive.files.copy")
+	if code := gdriver(s, userB, "migrate", userA); code != exitOK {
+		t.Fatalf("migrate exit code %d", code)
+	}
+	if n := s.Calls("drive.files.copy") - copies; n != 0 {
+		t.Errorf("%d files copied again", n)
+	}
+	if mp, err = readMigrationPlan(); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range mp.Files() {
+		if item.State != stateCopied || item.DestID != made[item.SourceID] {
+			t.Errorf("%s is %s as %s, want copied as %s", item.Path, item.State, item.DestID, made[item.SourceID])
+		}
+	}
+}
+
+func TestMigrateTagsCopies(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	migrated(t, s)
+
+	readme := byTitle(s.Files(userA), "readme.txt")[0]
+	c := byTitle(s.Files(userB), "readme.txt")[0]
+	if len(c.Properties) != 1 || c.Properties[0].Key != sourceProperty || c.Properties[0].Value != readme.Id ||
+		c.Properties[0].Visibility != "PRIVATE" {
+		t.Errorf("copy of readme.txt has properties %+v", c.Properties)
+	}
+}
+
+func TestMigratePermissionsFailure(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	if code := gdriver(s, userB, "prepare", userA); code != exitOK {
+		t.Fatalf("prepare exit code %d", code)
+	}
+
+	s.AddFault(fakedrive.Fault{Op: "drive.permissions.get", Code: 403, Reason: "forbidden", Times: 1})
+	if code := gdriver(s, userB, "migrate", userA); code != exitPartial {
+		t.Fatalf("migrate exit code %d, want %d", code, exitPartial)
+	}
+	if code := gdriver(s, userB, "check", userB); code != exitPartial {
+		t.Fatalf("check of a copy still shared: exit code %d, want %d", code, exitPartial)
+	}
+	mp, err := readMigrationPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := mp.Counts(); c[stateFailed] != 1 || c[stateVerified] != 1 {
+		t.Errorf("counts %v after check, want 1 failed and 1 verified", c)
+	}
+
+	copies := s.Calls("drive.files.copy")
+	if code := gdriver(s, userB, "migrate", userA); code != exitOK {
+		t.Fatalf("second migrate exit code %d", code)
+	}
+	if n := s.Calls("drive.files.copy") - copies; n != 0 {
+		t.Errorf("%d files copied again", n)
+	}
+	if code := gdriver(s, userB, "check", userB); code != exitOK {
+		t.Fatalf("check exit code %d", code)
+	}
+	if mp, err = readMigrationPlan(); err != nil {
+		t.Fatal(err)
+	}
+	if c := mp.Counts(); c[stateVerified] != 2 {
+		t.Errorf("counts %v, want 2 verified", c)
+	}
+}
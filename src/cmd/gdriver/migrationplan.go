@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"gdrive"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// planFile is the name of the migration plan in the working directory.
+const planFile = "plan.jsonl"
+
+// planVersion is the version of the plan format.
+const planVersion = 1
+
+// States of plan items
+const (
+	statePending  = "pending"  // not copied yet
+	stateCopying  = "copying"  // copy started, maybe made
+	stateCopied   = "copied"   // copied, not checked
+	stateVerified = "verified" // the copy matches the source
+	stateFailed   = "failed"   // copying or checking failed
+)
+
+// planHeader is the first line of the plan.
+type planHeader struct {
+	Version int    `json:"version"`
+	Account string `json:"account"`
+	Root    string `json:"root"`
+}
+
+// planItem is a file or folder to migrate, a line of the plan. Folders
+// are not copied, prepare recreates them and marks them copied.
+type planItem struct {
+	SourceID      string   `json:"sourceId"`
+	Title         string   `json:"title"`
+	Path          string   `json:"path"`
+	MimeType      string   `json:"mimeType"`
+	Folder        bool     `json:"folder,omitempty"`
+	Size          int64    `json:"size"`
+	MD5           string   `json:"md5,omitempty"`
+	ModifiedDate  string   `json:"modifiedDate"`
+	NotCopyable   bool     `json:"notCopyable,omitempty"`
+	SourceParents []string `json:"sourceParents"` // source folder IDs, "" for My Drive
+	Parents       []string `json:"parents"`       // destination folder IDs
+	State         string   `json:"state"`
+	DestID        string   `json:"destId,omitempty"`
+	Shared        bool     `json:"shared,omitempty"` // the copy still has permissions to remove
+	Error         string   `json:"error,omitempty"`
+}
+
+// newPlanItem returns the pending item of a source file.
+func newPlanItem(f *drive.File, path string) *planItem {
+	item := &planItem{
+		SourceID:     f.Id,
+		Title:        f.Title,
+		Path:         path,
+		MimeType:     f.MimeType,
+		Folder:       f.MimeType == gdrive.FolderMIME,
+		Size:         f.FileSize,
+		MD5:          f.Md5Checksum,
+		ModifiedDate: f.ModifiedDate,
+		NotCopyable:  f.MimeType != gdrive.FolderMIME && !f.Copyable,
+		State:        statePending,
+	}
+	for _, p := range f.Parents {
+		if p.IsRoot {
+			item.SourceParents = append(item.SourceParents, rootParent)
+		} else {
+			item.SourceParents = append(item.SourceParents, p.Id)
+		}
+	}
+	if len(f.Parents) == 0 {
+		item.SourceParents = []string{rootParent}
+	}
+	return item
+}
+
+// file returns the source file of the item as far as the plan knows it.
+func (item *planItem) file() *drive.File {
+	f := &drive.File{
+		Id:           item.SourceID,
+		Title:        item.Title,
+		MimeType:     item.MimeType,
+		FileSize:     item.Size,
+		Md5Checksum:  item.MD5,
+		ModifiedDate: item.ModifiedDate,
+	}
+	for _, id := range item.SourceParents {
+		f.Parents = append(f.Parents, &drive.ParentReference{Id: id, IsRoot: id == rootParent})
+	}
+	return f
+}
+
+// migrationPlan is the plan of a migration. Commands update the items
+// in memory and save the whole plan by replacing the file, so a reader
+// never sees a partly written plan. Saves during a run are spaced by
+// saveInterval.
+type migrationPlan struct {
+	planHeader
+	Items []*planItem
+
+	name  string
+	mu    sync.Mutex
+	saved time.Time
+}
+
+const saveInterval = time.Second
+
+// newMigrationPlan returns an empty plan of the working directory.
+func newMigrationPlan(account, root string) *migrationPlan {
+	return &migrationPlan{
+		planHeader: planHeader{Version: planVersion, Account: account, Root: root},
+		name:       filepath.Join(workDir, planFile),
+	}
+}
+
+// readMigrationPlan reads the plan of the working directory.
+func readMigrationPlan() (*migrationPlan, error) {
+	p := &migrationPlan{name: filepath.Join(workDir, planFile)}
+	f, err := os.Open(p.name)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Migration plan %s does not exist.\nUse gdriver prepare to create one", p.name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if n == 1 {
+			if err := json.Unmarshal(scanner.Bytes(), &p.planHeader); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", p.name, n, err)
+			}
+			if p.Version != planVersion {
+				return nil, fmt.Errorf("%s: unsupported plan version %d", p.name, p.Version)
+			}
+			continue
+		}
+		item := &planItem{}
+		if err := json.Unmarshal(scanner.Bytes(), item); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", p.name, n, err)
+		}
+		p.Items = append(p.Items, item)
+	}
+	return p, scanner.Err()
+}
+
+// Save writes the plan to a temporary file and renames it over the plan.
+func (p *migrationPlan) Save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.save()
+}
+
+func (p *migrationPlan) save() error {
+	tmp := p.name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	err = enc.Encode(&p.planHeader)
+	for _, item := range p.Items {
+		if err != nil {
+			break
+		}
+		err = enc.Encode(item)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("Unable to save migration plan: %v", err)
+	}
+	p.saved = time.Now()
+	return os.Rename(tmp, p.name)
+}
+
+// Update changes an item under the lock of the plan and saves the plan
+// when the last save is older than saveInterval.
+func (p *migrationPlan) Update(item *planItem, fn func(item *planItem)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn(item)
+	if time.Since(p.saved) < saveInterval {
+		return nil
+	}
+	return p.save()
+}
+
+// Files returns the items of the plan which are files.
+func (p *migrationPlan) Files() []*planItem {
+	var files []*planItem
+	for _, item := range p.Items {
+		if !item.Folder {
+			files = append(files, item)
+		}
+	}
+	return files
+}
+
+// Counts returns the number of files in each state.
+func (p *migrationPlan) Counts() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	counts := map[string]int{}
+	for _, item := range p.Items {
+		if !item.Folder {
+			counts[item.State]++
+		}
+	}
+	return counts
+}
+
+// intentFile is the name of the log of copies migrate started, in the
+// working directory.
+const intentFile = "intents.jsonl"
+
+// intent is a line of the intent log.
+type intent struct {
+	Time     time.Time `json:"time"`
+	SourceID string    `json:"sourceId"`
+}
+
+// intentLog records every copy before it is made. The plan is saved
+// only now and then, so after a crash the log tells which files may
+// have been copied already.
+type intentLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// openIntentLog returns the log and the source IDs recorded in it.
+func openIntentLog() (*intentLog, map[string]bool, error) {
+	name := filepath.Join(workDir, intentFile)
+	started := map[string]bool{}
+	if f, err := os.Open(name); err == nil {
+		scanner := bufio.NewScanner(f)
+		for n := 1; scanner.Scan(); n++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			e := &intent{}
+			if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+				// The last line of a crashed run may be cut short
+				debugf("%s:%d: %v\n", name, n, err)
+				continue
+			}
+			started[e.SourceID] = true
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to open intent log: %v", err)
+	}
+	return &intentLog{f: f, enc: json.NewEncoder(f)}, started, nil
+}
+
+// Record writes the intent to copy the file through to the disk.
+func (l *intentLog) Record(sourceID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.enc.Encode(&intent{Time: time.Now().UTC(), SourceID: sourceID})
+	if err == nil {
+		err = l.f.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to write intent log: %v", err)
+	}
+	return nil
+}
+
+func (l *intentLog) Close() error {
+	return l.f.Close()
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gdrive"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"util"
+
+	"github.com/cheggaaa/pb"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// prepareOptions select the destination root of prepare.
+type prepareOptions struct {
+	RootTitle string // title of a new root folder
+	RootID    string // existing destination folder, instead of a new one
+	Resume    bool   // continue an interrupted prepare
+	Outside   string // placement of parents outside the account
+	Workers   int    // folders created in parallel
+	PlanOnly  bool   // only write the plan, change nothing in Drive
+	FromPlan  bool   // execute the plan of the working directory
+}
+
+// rootProperty is the private property of the root folder created by
+// prepare. Its value is unique to the run.
+const rootProperty = "gdriverRoot"
+
+// findFolder returns the folder with the private property in the
+// destination parent, or nil. Without a parent it looks everywhere.
+func findFolder(srv *drive.Service, key, value, parentID string) (*drive.File, error) {
+	q := propertyQuery(key, value)
+	if parentID != "" {
+		q += fmt.Sprintf(" and %s in parents", quote(parentID))
+	}
+	found, err := listFiles(srv, q)
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return found[0], nil
+}
+
+// insertFolder creates the folder tagged with the private property. A
+// failed request may have created the folder anyway, so it is looked up
+// before the request is retried.
+func insertFolder(srv *drive.Service, folder *drive.File, key, value string) (*drive.File, error) {
+	folder.Properties = append(folder.Properties, &drive.Property{Key: key, Value: value, Visibility: "PRIVATE"})
+	parentID := ""
+	if len(folder.Parents) > 0 {
+		parentID = folder.Parents[0].Id
+	}
+
+	var r *drive.File
+	attempt := 0
+	err := retry(func() (err error) {
+		if attempt++; attempt > 1 {
+			if r, err = findFolder(srv, key, value, parentID); err != nil || r != nil {
+				return err
+			}
+		}
+		r, err = srv.Files.Insert(folder).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// createFolder creates the folder in the destination parents, tagged
+// with its source ID. When resuming, the folder left there by the
+// interrupted run is used instead.
+func createFolder(srv *drive.Service, folder *drive.File, parents []string, resume bool) (*drive.File, error) {
+	if resume {
+		existing, err := findFolder(srv, sourceProperty, folder.Id, parents[0])
+		if err != nil || existing != nil {
+			return existing, err
+		}
+	}
+
+	newFolder := &drive.File{Title: folder.Title, MimeType: gdrive.FolderMIME}
+	for _, id := range parents {
+		newFolder.Parents = append(newFolder.Parents, &drive.ParentReference{Id: id})
+	}
+	return insertFolder(srv, newFolder, sourceProperty, folder.Id)
+}
+
+// destParents returns the destination IDs of the planned parents.
+func destParents(m *folderMap, parents []string) []string {
+	var ids []string
+	for _, p := range parents {
+		if id, ok := m.Dest(p); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// createFolders creates the planned folders level by level, the folders
+// of a level by the workers in parallel. Folders in the map exist.
+func createFolders(srv *drive.Service, plan *folderPlan, m *folderMap, workers int, resume bool) error {
+	total, created := 0, 0
+	for _, level := range plan.Levels {
+		total += len(level)
+		for _, f := range level {
+			if _, ok := m.Dest(f.Id); ok {
+				created++
+			}
+		}
+	}
+	fmt.Printf("\nCreating %d folders in %d levels, %d exist\n", total, len(plan.Levels), created)
+
+	bar := pb.New(total)
+	bar.SetRefreshRate(time.Second)
+	bar.Set(created)
+	bar.Start()
+	defer bar.Finish()
+
+	for _, level := range plan.Levels {
+		var mu sync.Mutex
+		var firstErr error
+		queue := make(chan *drive.File)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for folder := range queue {
+					f, err := createFolder(srv, folder, destParents(m, plan.parents(folder)), resume)
+					if err == nil {
+						debugf("Created folder %s (%s)\n", folder.Title, f.Id)
+						err = m.Add(folder.Id, f.Id, folder.Title)
+					}
+					if err != nil {
+						fmt.Printf("E: %s: %s\n", folder.Title, err.Error())
+						mu.Lock()
+						if firstErr == nil {
+							firstErr = err
+						}
+						mu.Unlock()
+						continue
+					}
+					bar.Increment()
+				}
+			}()
+		}
+		for _, f := range level {
+			if interrupted() {
+				break
+			}
+			if _, ok := m.Dest(f.Id); !ok {
+				queue <- f
+			}
+		}
+		close(queue)
+		wg.Wait()
+
+		// Children need all folders of the level
+		if firstErr != nil {
+			return firstErr
+		}
+		if interrupted() {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// reportFolders lists the folders prepare leaves out.
+func reportFolders(what string, folders []*drive.File) {
+	if len(folders) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", what)
+	for _, f := range folders {
+		fmt.Printf("  %s (%s)\n", f.Title, f.Id)
+	}
+}
+
+// prepareRoot returns the destination root folder, creating it unless
+// it exists.
+func prepareRoot(srv *drive.Service, o *prepareOptions) (string, error) {
+	if o.RootID != "" {
+		var root *drive.File
+		err := retry(func() (err error) {
+			root, err = srv.Files.Get(o.RootID).Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+		if root.MimeType != gdrive.FolderMIME {
+			return "", fmt.Errorf("%s (%s) is not a folder", root.Title, root.Id)
+		}
+		fmt.Printf("Using root folder %s (%s)\n", root.Title, root.Id)
+		return root.Id, nil
+	}
+
+	rf := &drive.File{Title: o.RootTitle, MimeType: gdrive.FolderMIME}
+	fmt.Printf("Creating root folder %s", rf.Title)
+	rootFolder, err := insertFolder(srv, rf, rootProperty, time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		fmt.Println(" FAILED")
+		return "", err
+	}
+	fmt.Printf(" SUCCESS (%s)\n", rootFolder.Id)
+	return rootFolder.Id, nil
+}
+
+// buildPlan lists the files of the account and plans them and their
+// folders, without changing anything in Drive.
+func buildPlan(srv *drive.Service, accountFrom string, o *prepareOptions) (*migrationPlan, error) {
+	// List all files and folders
+	files, err := findAllFilesFrom(srv, accountFrom)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Found: %d files or directories\n", len(files))
+
+	// Folders outside the account are planned like its own
+	if o.Outside == outsideStubs {
+		folders := map[string]*drive.File{}
+		for _, f := range files {
+			if f.MimeType == gdrive.FolderMIME { // folder
+				folders[f.Id] = f
+			}
+		}
+		stubs, err := addStubs(srv, folders, files)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Found: %d folders outside the account to recreate\n", len(stubs))
+		for id := range stubs {
+			files = append(files, folders[id])
+		}
+	}
+
+	mp := newMigrationPlan(accountFrom, "")
+	ps := newPaths(srv, files)
+	for _, f := range files {
+		mp.Items = append(mp.Items, newPlanItem(f, ps.path(f)))
+	}
+	sort.SliceStable(mp.Items, func(i, j int) bool { return mp.Items[i].Path < mp.Items[j].Path })
+	return mp, nil
+}
+
+// executePlan creates the root and the folders of the plan and sets the
+// destination parents of its files. Items without a place in the
+// destination are left out of the plan.
+func executePlan(srv *drive.Service, mp *migrationPlan, m *folderMap, o *prepareOptions) error {
+	// Create new root folder, unless it was created before
+	resume := m.Root != ""
+	if !resume {
+		root, err := prepareRoot(srv, o)
+		if err != nil {
+			return err
+		}
+		if err := m.SetRoot(root); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Resuming with root folder %s and %d folders\n", m.Root, len(m.Folders))
+	}
+	mp.Root = m.Root
+
+	folders := map[string]*drive.File{}
+	for _, item := range mp.Items {
+		if item.Folder {
+			folders[item.SourceID] = item.file()
+		}
+	}
+	plan := planFolders(folders, o.Outside == outsideSkip)
+	if err := createFolders(srv, plan, m, o.Workers, resume); err != nil {
+		return err
+	}
+
+	// Destination parents
+	var items []*planItem
+	var skipped []*drive.File
+	for _, item := range mp.Items {
+		if item.Folder {
+			id, ok := m.Dest(item.SourceID)
+			if !ok {
+				continue // reported by the folder plan
+			}
+			item.DestID = id
+			item.State = stateCopied
+			items = append(items, item)
+			continue
+		}
+		planned := plan.parents(item.file())
+		if len(planned) == 0 {
+			skipped = append(skipped, item.file())
+			continue
+		}
+		item.Parents = destParents(m, planned)
+		items = append(items, item)
+	}
+	mp.Items = items
+	if err := mp.Save(); err != nil {
+		return err
+	}
+	if err := m.Finish(); err != nil {
+		return err
+	}
+	fmt.Printf("Prepare finished.\n")
+
+	reportFolders("Skipped folders with parents outside the account", plan.Skipped)
+	reportFolders("Folders in a cycle of parents", plan.Cycles)
+	reportFolders("Unreachable folders", plan.Unreachable)
+	reportFolders("Skipped files", skipped)
+
+	if n := len(plan.Cycles) + len(plan.Unreachable); n > 0 {
+		return &partialError{Failed: n, Total: len(folders)}
+	}
+	return nil
+}
+
+func prepare(srv *drive.Service, accountFrom string, o *prepareOptions) error {
+	// Create working directory
+	if !o.Resume && !o.FromPlan {
+		if err := os.Mkdir(workDir, 0770); err != nil {
+			return err
+		}
+	}
+
+	var m *folderMap
+	var err error
+	if !o.PlanOnly {
+		if m, err = openFolderMap(); err != nil {
+			return err
+		}
+		defer m.Close()
+		if m.Done {
+			return fmt.Errorf("Prepare already finished in %s.\nUse gdriver migrate", workDir)
+		}
+	}
+
+	// A resumed prepare executes the stored plan it was executing, and
+	// doesn't replace a plan written by --plan-only
+	if o.Resume && !o.FromPlan {
+		if m.FromPlan {
+			o.FromPlan = true
+		} else if stored, err := readMigrationPlan(); err == nil && stored.Root == "" {
+			return fmt.Errorf("The migration plan in %s was not executed yet.\nUse gdriver prepare --from-plan %s", workDir, accountFrom)
+		}
+	}
+
+	var mp *migrationPlan
+	if o.FromPlan {
+		if mp, err = readMigrationPlan(); err != nil {
+			return err
+		}
+		if mp.Account != accountFrom {
+			return fmt.Errorf("The migration plan is of %s, not %s", mp.Account, accountFrom)
+		}
+		fmt.Printf("Executing the plan of %d files and folders\n", len(mp.Items))
+	} else {
+		if mp, err = buildPlan(srv, accountFrom, o); err != nil {
+			return err
+		}
+	}
+
+	if o.PlanOnly {
+		if err := mp.Save(); err != nil {
+			return err
+		}
+		summarize(os.Stdout, mp)
+		fmt.Printf("\nReview the plan with gdriver review, then run gdriver prepare --from-plan %s\n", accountFrom)
+		return nil
+	}
+	if o.FromPlan && !m.FromPlan {
+		if err := m.SetFromPlan(); err != nil {
+			return err
+		}
+	}
+
+	// Everything is OK, unless folders could not be placed
+	return executePlan(srv, mp, m, o)
+}
+
+func runPrepare(fs *flag.FlagSet, args []string) error {
+	o := &prepareOptions{}
+	fs.StringVar(&o.RootTitle, "root-title", "MIGRACE", "`title` of the new root folder of the migrated files")
+	fs.StringVar(&o.RootID, "root-id", "", "existing destination folder `ID` instead of a new root folder")
+	fs.BoolVar(&o.Resume, "resume", false, "continue an interrupted prepare, reusing the folders already created")
+	fs.StringVar(&o.Outside, "outside", outsideRoot, "placement of folders and files with parents outside the account: root, stubs (recreate the parents) or skip")
+	fs.IntVar(&o.Workers, "workers", 5, "`number` of folders created in parallel")
+	fs.BoolVar(&o.PlanOnly, "plan-only", false, "only write and summarize the migration plan, without changing anything in Drive")
+	fs.BoolVar(&o.FromPlan, "from-plan", false, "execute the reviewed migration plan of the working directory")
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	accountFrom := args[0]
+
+	switch {
+	case o.Outside != outsideRoot && o.Outside != outsideStubs && o.Outside != outsideSkip:
+		err = fmt.Errorf("Unknown --outside placement %q", o.Outside)
+	case o.Workers < 1:
+		err = fmt.Errorf("--workers must be at least 1")
+	case o.PlanOnly && (o.Resume || o.FromPlan):
+		err = fmt.Errorf("--plan-only can't be combined with --resume or --from-plan")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n", err)
+		fs.Usage()
+		return errUsage
+	}
+
+	workExists, err := util.FileExists(workDir)
+	if err != nil {
+		return err
+	}
+	existing := o.Resume || o.FromPlan
+	if workExists && !existing {
+		return fmt.Errorf("Working directory %s already exists.\nUse gdriver prepare --resume, gdriver migrate or delete %s", workDir, workDir)
+	}
+	if !workExists && existing {
+		return fmt.Errorf("Working directory %s does not exist, nothing to resume", workDir)
+	}
+
+	srv, err := newService()
+	if err != nil {
+		return err
+	}
+
+	return prepare(srv, accountFrom, o)
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"gdrive/fakedrive"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/drive/v2"
+)
+
+func TestPrepare(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+
+	if code := gdriver(s, userB, "prepare", userA); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+
+	files := s.Files(userB)
+	root := byTitle(files, "MIGRACE")
+	if len(root) != 1 {
+		t.Fatalf("%d MIGRACE folders, want 1", len(root))
+	}
+	projects := byTitle(files, "Projects")
+	if len(projects) != 1 || projects[0].Parents[0].Id != root[0].Id {
+		t.Fatalf("Projects not created under MIGRACE: %v", projects)
+	}
+	acme := byTitle(files, "ACME")
+	if len(acme) != 1 || acme[0].Parents[0].Id != projects[0].Id {
+		t.Fatalf("ACME not created under Projects: %v", acme)
+	}
+	if docs := byTitle(files, "Docs"); len(docs) != 1 || docs[0].Parents[0].Id != acme[0].Id {
+		t.Fatalf("Docs not created under ACME: %v", docs)
+	}
+
+	mp, err := readMigrationPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mp.Files()) != 2 || len(mp.Items) != 5 || mp.Account != userA || mp.Root != root[0].Id {
+		t.Fatalf("plan %+v with %d items and %d files, want 5 and 2", mp.planHeader, len(mp.Items), len(mp.Files()))
+	}
+	readme := byTitle(s.Files(userA), "readme.txt")[0]
+	for _, item := range mp.Items {
+		if item.Folder && (item.State != stateCopied || item.DestID == "") {
+			t.Errorf("folder %s is %s (%q)", item.Path, item.State, item.DestID)
+		}
+		if item.SourceID != readme.Id {
+			continue
+		}
+		want := &planItem{
+			SourceID:      readme.Id,
+			Title:         "readme.txt",
+			Path:          "/Projects/readme.txt",
+			MimeType:      readme.MimeType,
+			Size:          readme.FileSize,
+			MD5:           readme.Md5Checksum,
+			ModifiedDate:  readme.ModifiedDate,
+			SourceParents: []string{readme.Parents[0].Id},
+			Parents:       []string{projects[0].Id},
+			State:         statePending,
+		}
+		if !reflect.DeepEqual(item, want) {
+			t.Errorf("readme.txt planned as %+v, want %+v", item, want)
+		}
+	}
+}
+
+func TestPrepareWorkDirExists(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+
+	if err := os.Mkdir(workDir, 0770); err != nil {
+		t.Fatal(err)
+	}
+	if code := gdriver(s, userB, "prepare", userA); code != exitFailure {
+		t.Fatalf("exit code %d, want %d", code, exitFailure)
+	}
+	if n := len(s.Files(userB)); n != 0 {
+		t.Errorf("%d files created, want none", n)
+	}
+}
+
+func TestPrepareRoot(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	dest := s.AddFolder(userB, "Archive", "")
+
+	if code := gdriver(s, userB, "prepare", "--root-id", dest.Id, userA); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	files := s.Files(userB)
+	if n := len(byTitle(files, "MIGRACE")); n != 0 {
+		t.Errorf("%d MIGRACE folders created", n)
+	}
+	if projects := byTitle(files, "Projects"); len(projects) != 1 || projects[0].Parents[0].Id != dest.Id {
+		t.Fatalf("Projects not created under Archive: %v", projects)
+	}
+
+	os.RemoveAll(workDir)
+	if code := gdriver(s, userB, "prepare", "--root-title", "From A", userA); code != exitOK {
+		t.Fatalf("root title: exit code %d", code)
+	}
+	if n := len(byTitle(s.Files(userB), "From A")); n != 1 {
+		t.Errorf("%d root folders titled From A, want 1", n)
+	}
+}
+
+func TestPrepareResume(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+
+	if code := gdriver(s, userB, "prepare", "--resume", userA); code != exitFailure {
+		t.Fatalf("resume without work directory: exit code %d, want %d", code, exitFailure)
+	}
+	if code := gdriver(s, userB, "prepare", userA); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	if code := gdriver(s, userB, "prepare", "--resume", userA); code != exitFailure {
+		t.Fatalf("resume of a finished prepare: exit code %d, want %d", code, exitFailure)
+	}
+
+	// Crash after the root and the first folder were recorded
+	name := filepath.Join(workDir, folderMapFile)
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		lines = append(lines, scanner.Text())
+	}
+	f.Close()
+	if err := ioutil.WriteFile(name, []byte(strings.Join(lines[:2], "\n")+"\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	inserts := s.Calls("drive.files.insert")
+	if code := gdriver(s, userB, "prepare", "--resume", userA); code != exitOK {
+		t.Fatalf("resume: exit code %d", code)
+	}
+	if n := s.Calls("drive.files.insert") - inserts; n != 0 {
+		t.Errorf("%d folders created on resume, want none", n)
+	}
+	files := s.Files(userB)
+	for _, title := range []string{"MIGRACE", "Projects", "ACME", "Docs"} {
+		if n := len(byTitle(files, title)); n != 1 {
+			t.Errorf("%d %s folders, want 1", n, title)
+		}
+	}
+
+	migrated := 0
+	if code := gdriver(s, userB, "migrate", userA); code != exitOK {
+		t.Fatalf("migrate exit code %d", code)
+	}
+	for _, f := range s.Files(userB) {
+		if f.Title == "readme.txt" || f.Title == "spec.txt" {
+			migrated++
+		}
+	}
+	if migrated != 2 {
+		t.Errorf("%d files migrated, want 2", migrated)
+	}
+}
+
+func TestPrepareOutside(t *testing.T) {
+	for _, tt := range []struct {
+		outside string
+		parent  string // title of the parent of Sub
+		files   int    // planned files
+	}{
+		{outsideRoot, "MIGRACE", 3},
+		{outsideStubs, "Team", 3},
+		{outsideSkip, "", 2},
+	} {
+		t.Run(tt.outside, func(t *testing.T) {
+			s, done := setup(t)
+			defer done()
+			fixture(s)
+			// A folder of userA in a folder userB can see, but doesn't own
+			team := s.AddFolder("c@example.com", "Team", "")
+			s.Share(team.Id, userA, "writer")
+			s.Share(team.Id, userB, "reader")
+			sub := s.AddFolder(userA, "Sub", team.Id)
+			plan := s.AddFile(userA, "plan.txt", sub.Id, "plan")
+			s.Share(sub.Id, userB, "reader")
+			s.Share(plan.Id, userB, "reader")
+
+			if code := gdriver(s, userB, "prepare", "--outside", tt.outside, userA); code != exitOK {
+				t.Fatalf("exit code %d", code)
+			}
+			files := s.Files(userB)
+			subs := byTitle(files, "Sub")
+			if tt.parent == "" {
+				if len(subs) != 0 {
+					t.Errorf("%d Sub folders created, want none", len(subs))
+				}
+			} else {
+				if len(subs) != 1 {
+					t.Fatalf("%d Sub folders, want 1", len(subs))
+				}
+				parent := s.File(subs[0].Parents[0].Id)
+				if parent.Title != tt.parent {
+					t.Errorf("Sub created in %s, want %s", parent.Title, tt.parent)
+				}
+			}
+			mp, err := readMigrationPlan()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(mp.Files()); n != tt.files {
+				t.Errorf("%d files planned, want %d", n, tt.files)
+			}
+		})
+	}
+}
+
+func TestPrepareCycle(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	_, acme := fixture(s)
+	projects := byTitle(s.Files(userA), "Projects")[0]
+	s.Update(projects.Id, func(f *drive.File) {
+		f.Parents = []*drive.ParentReference{{Id: acme}}
+	})
+
+	if code := gdriver(s, userB, "prepare", userA); code != exitPartial {
+		t.Fatalf("exit code %d, want %d", code, exitPartial)
+	}
+	if n := len(byTitle(s.Files(userB), "Projects")); n != 0 {
+		t.Errorf("%d Projects folders created, want none", n)
+	}
+}
+
+func TestPrepareResumeSameTitles(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	projects, _ := fixture(s)
+	for _, f := range []*drive.File{s.AddFolder(userA, "Dup", projects), s.AddFolder(userA, "Dup", projects)} {
+		s.Share(f.Id, userB, "reader")
+	}
+
+	if code := gdriver(s, userB, "prepare", userA); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+
+	// Crash before the second Dup and the end were recorded
+	name := filepath.Join(workDir, folderMapFile)
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	dups := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if strings.Contains(line, `"title":"Dup"`) {
+			if dups++; dups == 2 {
+				continue
+			}
+		}
+		if !strings.Contains(line, `"done"`) {
+			lines = append(lines, line)
+		}
+	}
+	if err := ioutil.WriteFile(name, []byte(strings.Join(lines, "\n")+"\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	inserts := s.Calls("drive.files.insert")
+	if code := gdriver(s, userB, "prepare", "--resume", userA); code != exitOK {
+		t.Fatalf("resume: exit code %d", code)
+	}
+	if n := s.Calls("drive.files.insert") - inserts; n != 0 {
+		t.Errorf("%d folders created on resume, want none", n)
+	}
+	mp, err := readMigrationPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := map[string]bool{}
+	for _, item := range mp.Items {
+		if item.Title == "Dup" {
+			dest[item.DestID] = true
+		}
+	}
+	if len(dest) != 2 {
+		t.Errorf("the Dup folders were mapped to %d destination folders, want 2", len(dest))
+	}
+}
+
+func TestPrepareLostResponse(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	s.AddFault(fakedrive.Fault{Op: "drive.files.insert", Code: 503, After: true, Times: 2})
+
+	if code := gdriver(s, userB, "prepare", userA); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	files := s.Files(userB)
+	for _, title := range []string{"MIGRACE", "Projects", "ACME", "Docs"} {
+		if n := len(byTitle(files, title)); n != 1 {
+			t.Errorf("%d %s folders, want 1", n, title)
+		}
+	}
+}
+
+func TestPrepareResumeFromPlan(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+
+	if code := gdriver(s, userB, "prepare", "--plan-only", userA); code != exitOK {
+		t.Fatalf("plan-only exit code %d", code)
+	}
+	if code := gdriver(s, userB, "prepare", "--resume", userA); code != exitFailure {
+		t.Fatalf("resume of an unexecuted plan: exit code %d, want %d", code, exitFailure)
+	}
+	if code := gdriver(s, userB, "review", "--exclude-path", "/Projects/ACME"); code != exitOK {
+		t.Fatalf("review exit code %d", code)
+	}
+	reviewed, err := ioutil.ReadFile(filepath.Join(workDir, planFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := gdriver(s, userB, "prepare", "--from-plan", userA); code != exitOK {
+		t.Fatalf("from-plan exit code %d", code)
+	}
+
+	// Crash after the root was created, before the plan was saved
+	name := filepath.Join(workDir, folderMapFile)
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if err := ioutil.WriteFile(name, []byte(strings.Join(lines[:2], "\n")+"\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(workDir, planFile), reviewed, 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := gdriver(s, userB, "prepare", "--resume", userA); code != exitOK {
+		t.Fatalf("resume exit code %d", code)
+	}
+	files := s.Files(userB)
+	if n := len(byTitle(files, "Projects")); n != 1 {
+		t.Errorf("%d Projects folders, want 1", n)
+	}
+	for _, title := range []string{"ACME", "Docs"} {
+		if n := len(byTitle(files, title)); n != 0 {
+			t.Errorf("excluded folder %s created on resume", title)
+		}
+	}
+	mp, err := readMigrationPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range mp.Items {
+		if strings.HasPrefix(item.Path, "/Projects/ACME") {
+			t.Errorf("excluded %s back in the plan", item.Path)
+		}
+	}
+}
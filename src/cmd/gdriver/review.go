@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+// humanBytes formats a size for people, e.g. 1.5 MB.
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// summarize describes the plan for a review: the destination tree with
+// the files and bytes of every folder, files which can't be copied and
+// items whose parents are not in the plan.
+func summarize(w io.Writer, mp *migrationPlan) {
+	folders := map[string]bool{}
+	for _, item := range mp.Items {
+		if item.Folder {
+			folders[item.SourceID] = true
+		}
+	}
+
+	type dir struct {
+		files int
+		bytes int64
+	}
+	dirs := map[string]*dir{rootParent: {}}
+	var total int64
+	var notCopyable, missing []*planItem
+	for _, item := range mp.Items {
+		if item.Folder {
+			dirs[item.SourceID] = &dir{}
+		}
+	}
+	for _, item := range mp.Items {
+		lost := false
+		for _, id := range item.SourceParents {
+			if id != rootParent && !folders[id] {
+				lost = true
+			}
+		}
+		if lost {
+			missing = append(missing, item)
+		}
+		if item.Folder {
+			continue
+		}
+		total += item.Size
+		if item.NotCopyable {
+			notCopyable = append(notCopyable, item)
+		}
+		for _, id := range item.SourceParents {
+			if d := dirs[id]; d != nil {
+				d.files++
+				d.bytes += item.Size
+			}
+		}
+	}
+
+	counts := mp.Counts()
+	fmt.Fprintf(w, "Migration plan of %s\n", mp.Account)
+	fmt.Fprintf(w, "Folders: %d\n", len(folders))
+	fmt.Fprintf(w, "Files: %d, %s\n", len(mp.Files()), humanBytes(total))
+	if counts[statePending] != len(mp.Files()) {
+		fmt.Fprintf(w, "States: %d pending, %d copying, %d copied, %d verified, %d failed\n",
+			counts[statePending], counts[stateCopying], counts[stateCopied], counts[stateVerified], counts[stateFailed])
+	}
+	fmt.Fprintf(w, "Not copyable: %d\n", len(notCopyable))
+	fmt.Fprintf(w, "Missing parents: %d\n", len(missing))
+
+	fmt.Fprintf(w, "\nDestination tree:\n")
+	d := dirs[rootParent]
+	fmt.Fprintf(w, "  %-50s %6d files %10s\n", "/", d.files, humanBytes(d.bytes))
+	for _, item := range mp.Items {
+		if item.Folder {
+			d := dirs[item.SourceID]
+			fmt.Fprintf(w, "  %-50s %6d files %10s\n", item.Path+"/", d.files, humanBytes(d.bytes))
+		}
+	}
+
+	if len(notCopyable) > 0 {
+		fmt.Fprintf(w, "\nNot copyable files:\n")
+		for _, item := range notCopyable {
+			fmt.Fprintf(w, "  %s (%s)\n", item.Path, item.SourceID)
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(w, "\nItems with parents missing from the plan:\n")
+		for _, item := range missing {
+			fmt.Fprintf(w, "  %s (%s)\n", item.Path, item.SourceID)
+		}
+	}
+}
+
+// matchPath reports whether the path or one of its folders matches a
+// glob, so a folder matches its whole subtree.
+func matchPath(globs []string, p string) bool {
+	for _, g := range globs {
+		for q := p; q != "/" && q != "."; q = path.Dir(q) {
+			if ok, _ := path.Match(g, q); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterPlan removes the pending items the filters leave out. Paths
+// select files and folders, the other filters files only.
+func filterPlan(mp *migrationPlan, paths, excludePaths []string, sc *scope) (files, folders int) {
+	var items []*planItem
+	for _, item := range mp.Items {
+		keep := item.State != statePending ||
+			(len(paths) == 0 || matchPath(paths, item.Path)) &&
+				!matchPath(excludePaths, item.Path) &&
+				(item.Folder || sc.match(item.file()))
+		switch {
+		case keep:
+			items = append(items, item)
+		case item.Folder:
+			folders++
+		default:
+			files++
+		}
+	}
+	mp.Items = items
+	return files, folders
+}
+
+func runReview(fs *flag.FlagSet, args []string) error {
+	var paths, excludePaths stringList
+	fs.Var(&paths, "path", "only files and folders with the path or a folder matching the `glob`, e.g. /Projects (repeatable)")
+	fs.Var(&excludePaths, "exclude-path", "remove files and folders with the path or a folder matching the `glob` (repeatable)")
+	sc := &scope{}
+	sc.filterFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "only show the filtered plan, don't save it")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	err := sc.validate()
+	for _, g := range append(append([]string{}, paths...), excludePaths...) {
+		if _, perr := path.Match(g, ""); perr != nil && err == nil {
+			err = fmt.Errorf("Invalid path glob %q", g)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n", err)
+		fs.Usage()
+		return errUsage
+	}
+
+	mp, err := readMigrationPlan()
+	if err != nil {
+		return err
+	}
+	files, folders := filterPlan(mp, paths, excludePaths, sc)
+	summarize(os.Stdout, mp)
+	if files+folders == 0 {
+		return nil
+	}
+
+	removed := fmt.Sprintf("%d files and %d folders", files, folders)
+	if *dryRun {
+		fmt.Printf("\nWould remove %s from the plan\n", removed)
+		return nil
+	}
+	if err := mp.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("\nRemoved %s from the plan\n", removed)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPlanReview(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+
+	if code := gdriver(s, userB, "prepare", "--plan-only", userA); code != exitOK {
+		t.Fatalf("plan-only exit code %d", code)
+	}
+	if n := s.Calls("drive.files.insert"); n != 0 {
+		t.Fatalf("plan-only created %d files", n)
+	}
+	if code := gdriver(s, userB, "migrate", userA); code != exitFailure {
+		t.Errorf("migrate before the plan is executed: exit code %d, want %d", code, exitFailure)
+	}
+
+	if code := gdriver(s, userB, "review", "--dry-run", "--exclude-path", "/Projects/ACME"); code != exitOK {
+		t.Fatalf("review dry run exit code %d", code)
+	}
+	if mp, err := readMigrationPlan(); err != nil || len(mp.Items) != 5 {
+		t.Fatalf("dry run changed the plan: %v", err)
+	}
+	if code := gdriver(s, userB, "review", "--exclude-path", "/Projects/ACME"); code != exitOK {
+		t.Fatalf("review exit code %d", code)
+	}
+
+	if code := gdriver(s, userB, "prepare", "--from-plan", userA); code != exitOK {
+		t.Fatalf("from-plan exit code %d", code)
+	}
+	if code := gdriver(s, userB, "migrate", userA); code != exitOK {
+		t.Fatalf("migrate exit code %d", code)
+	}
+	files := s.Files(userB)
+	for title, want := range map[string]int{"Projects": 1, "readme.txt": 1, "ACME": 0, "Docs": 0, "spec.txt": 0} {
+		if n := len(byTitle(files, title)); n != want {
+			t.Errorf("%d copies of %s, want %d", n, title, want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	mp := newMigrationPlan(userA, "")
+	mp.Items = []*planItem{
+		{SourceID: "p", Path: "/Projects", Folder: true, SourceParents: []string{""}, State: statePending},
+		{SourceID: "a", Path: "/Projects/a.txt", Size: 2048, SourceParents: []string{"p"}, State: statePending},
+		{SourceID: "b", Path: "/Projects/b.doc", NotCopyable: true, SourceParents: []string{"p"}, State: statePending},
+		{SourceID: "c", Path: "/Other/c.txt", Size: 10, SourceParents: []string{"other"}, State: statePending},
+	}
+
+	var b bytes.Buffer
+	summarize(&b, mp)
+	for _, want := range []string{
+		"Folders: 1\n",
+		"Files: 3, 2.0 KB\n",
+		"Not copyable: 1\n",
+		"Missing parents: 1\n",
+		"  /Projects/b.doc (b)\n",
+		"  /Other/c.txt (c)\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("summary without %q:\n%s", want, b.String())
+		}
+	}
+
+	sc := &scope{MaxSize: 1024}
+	if files, folders := filterPlan(mp, nil, []string{"/Other"}, sc); files != 2 || folders != 0 {
+		t.Errorf("removed %d files and %d folders, want 2 and 0", files, folders)
+	}
+	if len(mp.Items) != 2 || mp.Items[1].SourceID != "b" {
+		t.Errorf("%d items left after filtering", len(mp.Items))
+	}
+}
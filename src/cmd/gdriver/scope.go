@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// stringList is a flag which can be given more times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// dateFlag is a date or time flag, e.g. 2015-06-30 or
+// 2015-06-30T12:00:00Z.
+type dateFlag struct {
+	time.Time
+}
+
+func (d *dateFlag) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format(time.RFC3339)
+}
+
+func (d *dateFlag) Set(v string) error {
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, v); err == nil {
+			d.Time = t
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid date %q, use YYYY-MM-DD or RFC 3339", v)
+}
+
+// scope selects the files of an owner a command works on: everything
+// owned, a folder subtree, a Drive query, narrowed by filters.
+type scope struct {
+	FolderID string
+	Query    string
+
+	MIMETypes        stringList // MIME types or prefixes ending with /
+	ExcludeMIMETypes stringList
+	Titles           stringList // title globs
+	ExcludeTitles    stringList
+	ModifiedAfter    dateFlag
+	ModifiedBefore   dateFlag
+	MinSize          int64
+	MaxSize          int64 // 0 means no limit
+}
+
+// flags registers the scope flags in fs.
+func (s *scope) flags(fs *flag.FlagSet) {
+	fs.StringVar(&s.FolderID, "folder", "", "only files in the folder `ID` and its subfolders")
+	fs.StringVar(&s.Query, "query", "", "only files matching the Drive search `query`")
+	s.filterFlags(fs)
+}
+
+// filterFlags registers the flags of the filters applied by match.
+func (s *scope) filterFlags(fs *flag.FlagSet) {
+	fs.Var(&s.MIMETypes, "mime", "only files of the MIME `type`, a prefix like image/ matches all images (repeatable)")
+	fs.Var(&s.ExcludeMIMETypes, "exclude-mime", "skip files of the MIME `type` (repeatable)")
+	fs.Var(&s.Titles, "title", "only files with titles matching the `glob` (repeatable)")
+	fs.Var(&s.ExcludeTitles, "exclude-title", "skip files with titles matching the `glob` (repeatable)")
+	fs.Var(&s.ModifiedAfter, "modified-after", "only files modified after the `date`")
+	fs.Var(&s.ModifiedBefore, "modified-before", "only files modified before the `date`")
+	fs.Int64Var(&s.MinSize, "min-size", 0, "only files of at least `bytes`")
+	fs.Int64Var(&s.MaxSize, "max-size", 0, "only files of at most `bytes`")
+}
+
+// validate checks the globs.
+func (s *scope) validate() error {
+	for _, g := range append(append([]string{}, s.Titles...), s.ExcludeTitles...) {
+		if _, err := path.Match(g, ""); err != nil {
+			return fmt.Errorf("Invalid title glob %q", g)
+		}
+	}
+	return nil
+}
+
+// files returns the files owned by owner in the scope.
+func (s *scope) files(srv *drive.Service, owner string) ([]*drive.File, error) {
+	var files []*drive.File
+	var err error
+	if s.FolderID != "" {
+		files, err = findFilesInFolder(srv, s.FolderID, owner)
+	} else {
+		files, err = findAllFilesFrom(srv, owner)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var matching map[string]bool
+	if s.Query != "" {
+		found, err := listFiles(srv, "("+s.Query+") and '"+owner+"' in owners")
+		if err != nil {
+			return nil, err
+		}
+		matching = map[string]bool{}
+		for _, f := range found {
+			matching[f.Id] = true
+		}
+	}
+
+	var selected []*drive.File
+	for _, f := range files {
+		if matching != nil && !matching[f.Id] {
+			continue
+		}
+		if s.match(f) {
+			selected = append(selected, f)
+		}
+	}
+	return selected, nil
+}
+
+// match applies the filters to the file.
+func (s *scope) match(f *drive.File) bool {
+	if len(s.MIMETypes) > 0 && !matchMIME(s.MIMETypes, f.MimeType) {
+		return false
+	}
+	if matchMIME(s.ExcludeMIMETypes, f.MimeType) {
+		return false
+	}
+	if len(s.Titles) > 0 && !matchTitle(s.Titles, f.Title) {
+		return false
+	}
+	if matchTitle(s.ExcludeTitles, f.Title) {
+		return false
+	}
+
+	if !s.ModifiedAfter.IsZero() || !s.ModifiedBefore.IsZero() {
+		modified, err := time.Parse(time.RFC3339, f.ModifiedDate)
+		if err != nil {
+			return false
+		}
+		if !s.ModifiedAfter.IsZero() && !modified.After(s.ModifiedAfter.Time) {
+			return false
+		}
+		if !s.ModifiedBefore.IsZero() && !modified.Before(s.ModifiedBefore.Time) {
+			return false
+		}
+	}
+
+	if f.FileSize < s.MinSize {
+		return false
+	}
+	if s.MaxSize > 0 && f.FileSize > s.MaxSize {
+		return false
+	}
+	return true
+}
+
+func matchMIME(types []string, mimeType string) bool {
+	for _, t := range types {
+		if t == mimeType || strings.HasSuffix(t, "/") && strings.HasPrefix(mimeType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTitle(globs []string, title string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, title); ok {
+			return true
+		}
+	}
+	return false
+}
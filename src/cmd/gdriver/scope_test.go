@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// sharedWith returns the titles of userA's files shared with email.
+func sharedWith(files []*drive.File, email string) map[string]bool {
+	m := map[string]bool{}
+	for _, f := range files {
+		if _, ok := grantees(f)[email]; ok {
+			m[f.Title] = true
+		}
+	}
+	return m
+}
+
+func TestShareScope(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	_, acme := fixture(s)
+	s.AddFile(userA, "big.bin", acme, "0123456789")
+
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--folder", acme}, []string{"ACME", "Docs", "spec.txt", "big.bin"}},
+		{[]string{"--query", "title contains 'read'"}, []string{"readme.txt"}},
+		{[]string{"--folder", acme, "--exclude-mime", "application/vnd.google-apps.folder", "--exclude-title", "*.bin"}, []string{"spec.txt"}},
+		{[]string{"--title", "*.txt", "--title", "*.bin", "--min-size", "8"}, []string{"spec.txt", "big.bin"}},
+		{[]string{"--mime", "application/", "--exclude-mime", "application/vnd.google-apps.folder", "--max-size", "7"}, []string{"readme.txt"}},
+		{[]string{"--modified-after", "2100-01-01"}, nil},
+	} {
+		grantee := "c@example.com"
+		args := append(append([]string{"share"}, tt.args...), userA, grantee)
+		if code := gdriver(s, userA, args...); code != exitOK {
+			t.Errorf("%v: exit code %d", tt.args, code)
+			continue
+		}
+
+		got := sharedWith(s.Files(userA), grantee)
+		if len(got) != len(tt.want) {
+			t.Errorf("%v: shared %v, want %v", tt.args, got, tt.want)
+		}
+		for _, title := range tt.want {
+			if !got[title] {
+				t.Errorf("%v: %s not shared", tt.args, title)
+			}
+		}
+		gdriver(s, userA, "unshare", userA, grantee)
+	}
+
+	if code := gdriver(s, userA, "share", "--title", "[", userA, userB); code != exitUsage {
+		t.Errorf("invalid glob: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+func TestFindFilesInFolder(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	projects, acme := fixture(s)
+	docs := byTitle(s.Files(userA), "Docs")[0]
+	spec := byTitle(s.Files(userA), "spec.txt")[0]
+	// spec.txt is in ACME and Docs, and ACME is in Docs too
+	s.Update(spec.Id, func(f *drive.File) {
+		f.Parents = append(f.Parents, &drive.ParentReference{Id: docs.Id})
+	})
+	s.Update(acme, func(f *drive.File) {
+		f.Parents = []*drive.ParentReference{{Id: projects}, {Id: docs.Id}}
+	})
+
+	srv, err := s.Service(userA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := findFilesInFolder(srv, projects, userA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := map[string]int{}
+	for _, f := range files {
+		count[f.Title]++
+	}
+	if len(files) != 5 || count["spec.txt"] != 1 || count["ACME"] != 1 {
+		t.Errorf("found %v, want every file once", count)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cheggaaa/pb"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// shareOptions describe the permissions share grants.
+type shareOptions struct {
+	Role     string // reader, commenter or writer
+	Type     string // user, group, domain or anyone
+	WithLink bool   // only people with the link, for domain and anyone
+	Notify   bool   // send notification emails to users and groups
+	Message  string // custom text of the notification
+}
+
+// permission returns the permission granting the role to value, the
+// email or domain of the grantee.
+func (o *shareOptions) permission(value string) *drive.Permission {
+	p := &drive.Permission{Value: value, Type: o.Type, Role: o.Role, WithLink: o.WithLink}
+	if o.Role == "commenter" {
+		// Commenters are readers with an additional role in v2
+		p.Role = "reader"
+		p.AdditionalRoles = []string{"commenter"}
+	}
+	return p
+}
+
+// validate checks the role and grantee type and returns the grantees
+// to share with.
+func (o *shareOptions) validate(grantees []string) ([]string, error) {
+	switch o.Role {
+	case "reader", "commenter", "writer":
+	default:
+		return nil, fmt.Errorf("Unknown role %q", o.Role)
+	}
+	switch o.Type {
+	case "user", "group", "domain":
+		if len(grantees) == 0 {
+			return nil, fmt.Errorf("No %s to share with", o.Type)
+		}
+	case "anyone":
+		if len(grantees) > 0 {
+			return nil, fmt.Errorf("Grantees can't be given with type anyone")
+		}
+		grantees = []string{""}
+	default:
+		return nil, fmt.Errorf("Unknown grantee type %q", o.Type)
+	}
+	if o.WithLink && o.Type != "domain" && o.Type != "anyone" {
+		return nil, fmt.Errorf("--with-link applies only to types domain and anyone")
+	}
+	return grantees, nil
+}
+
+// Outcomes of sharing a file with a grantee
+const (
+	shareInserted = "inserted"
+	shareUpgraded = "upgraded"
+	shareSkipped  = "skipped"
+	shareFailed   = "failed"
+)
+
+// roleRank orders the roles of permissions, commenter being between
+// reader and writer.
+func roleRank(p *drive.Permission) int {
+	switch p.Role {
+	case "owner":
+		return 4
+	case "writer":
+		return 3
+	case "reader":
+		for _, r := range p.AdditionalRoles {
+			if r == "commenter" {
+				return 2
+			}
+		}
+		return 1
+	}
+	return 0
+}
+
+// grantee is someone to share with and the way to recognize their
+// existing permissions.
+type grantee struct {
+	Value string
+	Match func(p *drive.Permission) bool
+}
+
+// lookupGrantees resolves the permission IDs of the grantees once for
+// the whole run.
+func lookupGrantees(srv *drive.Service, values []string, o *shareOptions) ([]grantee, error) {
+	var gs []grantee
+	for _, v := range values {
+		match, err := permissionMatcher(srv, o.Type, v)
+		if err != nil {
+			return nil, err
+		}
+		if o.Type == "domain" || o.Type == "anyone" {
+			// Link and discoverable permissions are separate
+			m := match
+			match = func(p *drive.Permission) bool {
+				return m(p) && p.WithLink == o.WithLink
+			}
+		}
+		gs = append(gs, grantee{Value: v, Match: match})
+	}
+	return gs, nil
+}
+
+// filePermissions returns the permissions of the file, listing them
+// when the file wasn't fetched with them.
+func filePermissions(srv *drive.Service, file *drive.File) ([]*drive.Permission, error) {
+	if file.Permissions != nil {
+		return file.Permissions, nil
+	}
+	var list *drive.PermissionList
+	err := retry(func() (err error) {
+		list, err = srv.Permissions.List(file.Id).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// shareFile grants the role to the grantee unless they already have it
+// or a higher one. A lower role is upgraded. The returned entry records
+// the change for the journal.
+func shareFile(srv *drive.Service, file *drive.File, perms []*drive.Permission, g grantee, o *shareOptions) (*journalEntry, error) {
+	p := o.permission(g.Value)
+	e := &journalEntry{
+		FileID:   file.Id,
+		Title:    file.Title,
+		Type:     o.Type,
+		Value:    g.Value,
+		WithLink: o.WithLink,
+		Role:     o.Role,
+	}
+
+	var existing *drive.Permission
+	for _, ep := range perms {
+		if g.Match(ep) {
+			existing = ep
+			break
+		}
+	}
+	if existing != nil {
+		e.PermissionID = existing.Id
+		e.PreviousRole = roleName(existing)
+		if roleRank(existing) >= roleRank(p) {
+			e.Role = e.PreviousRole
+			e.Outcome = shareSkipped
+			return e, nil
+		}
+	}
+
+	var err error
+	if existing == nil {
+		e.Outcome = shareInserted
+		err = retry(func() error {
+			call := srv.Permissions.Insert(file.Id, p).SendNotificationEmails(o.Notify)
+			if o.Notify && o.Message != "" {
+				call = call.EmailMessage(o.Message)
+			}
+			inserted, err := call.Context(ctx).Do()
+			if err == nil {
+				e.PermissionID = inserted.Id
+			}
+			return err
+		})
+	} else {
+		e.Outcome = shareUpgraded
+		patch := rolePermission(&drive.Permission{}, o.Role)
+		err = retry(func() error {
+			_, err := srv.Permissions.Patch(file.Id, existing.Id, patch).Context(ctx).Do()
+			return err
+		})
+	}
+	if err != nil {
+		e.Outcome = shareFailed
+		e.Error = err.Error()
+		debugf("Sharing %s to %s: %v\n", file.Title, g.Value, err)
+	}
+
+	return e, err
+}
+
+// shareResult is the outcome of sharing one file to all grantees.
+type shareResult struct {
+	File    *drive.File
+	Entries []*journalEntry
+	Err     error // first failure
+}
+
+// shareToAll shares the file to every grantee and journals the changes.
+// A failed grantee does not stop the others.
+func shareToAll(srv *drive.Service, file *drive.File, grantees []grantee, o *shareOptions, j *journal) *shareResult {
+	r := &shareResult{File: file}
+	perms, err := filePermissions(srv, file)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	for _, g := range grantees {
+		e, err := shareFile(srv, file, perms, g, o)
+		if jerr := j.Write(e); jerr != nil && err == nil {
+			err = jerr
+		}
+		r.Entries = append(r.Entries, e)
+		if err != nil && r.Err == nil {
+			r.Err = fmt.Errorf("%s: %v", g.Value, err)
+		}
+	}
+	return r
+}
+
+func share(srv *drive.Service, accountFrom string, sc *scope, values []string, o *shareOptions, workers int, j *journal) error {
+	grantees, err := lookupGrantees(srv, values, o)
+	if err != nil {
+		return err
+	}
+
+	// List the files and folders in scope
+	files, err := sc.files(srv, accountFrom)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Found: %d files or directories\n", len(files))
+
+	// Progress bar
+	bar := pb.New(len(files))
+	bar.SetRefreshRate(time.Second)
+	bar.Start()
+
+	// Workers share the limiter of the service, results are kept in
+	// the order of the files.
+	results := make([]*shareResult, len(files))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = shareToAll(srv, files[i], grantees, o, j)
+				bar.Increment()
+			}
+		}()
+	}
+	for i := range files {
+		if interrupted() {
+			break
+		}
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	bar.FinishPrint("Done.")
+
+	counts := map[string]int{}
+	failed := 0
+	for _, r := range results {
+		if r == nil {
+			continue // not started before the interrupt
+		}
+		for _, e := range r.Entries {
+			counts[e.Outcome]++
+		}
+		if r.Err != nil {
+			if failed == 0 {
+				fmt.Printf("Failed:\n")
+			}
+			fmt.Printf("  %s (%s): %v\n", r.File.Title, r.File.Id, r.Err)
+			failed++
+		}
+	}
+	fmt.Printf("Inserted %d, upgraded %d, skipped %d, failed %d permissions\n",
+		counts[shareInserted], counts[shareUpgraded], counts[shareSkipped], counts[shareFailed])
+
+	if failed > 0 {
+		return &partialError{Failed: failed, Total: len(files)}
+	}
+
+	// Everything is OK
+	return nil
+}
+
+func runShare(fs *flag.FlagSet, args []string) error {
+	o := &shareOptions{}
+	fs.StringVar(&o.Role, "role", "reader", "`role` to grant: reader, commenter or writer")
+	fs.StringVar(&o.Type, "type", "user", "grantee `type`: user, group, domain or anyone")
+	fs.BoolVar(&o.WithLink, "with-link", false, "only people with the link, for types domain and anyone")
+	fs.BoolVar(&o.Notify, "notify", false, "send notification emails to users and groups")
+	fs.StringVar(&o.Message, "message", "", "custom `text` of the notification email")
+	sc := &scope{}
+	sc.flags(fs)
+	journalFile := fs.String("journal", defaultJournal("share"), "journal `file` the changes are appended to, for rollback")
+	workers := fs.Int("workers", 5, "`number` of files shared in parallel")
+	args, err := parseArgsMin(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	accountFrom := args[0]
+
+	grantees, err := o.validate(args[1:])
+	if err == nil {
+		err = sc.validate()
+	}
+	if err == nil && *workers < 1 {
+		err = fmt.Errorf("--workers must be at least 1")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n", err)
+		fs.Usage()
+		return errUsage
+	}
+
+	srv, err := newService()
+	if err != nil {
+		return err
+	}
+
+	to := strings.Join(grantees, ", ")
+	if o.Type == "anyone" {
+		to = "anyone"
+	}
+	j, err := openJournal(*journalFile)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	log.Printf("Sharing files owned by %s to %s as %s", accountFrom, to, o.Role)
+	log.Printf("Journal: %s", *journalFile)
+
+	return share(srv, accountFrom, sc, grantees, o, *workers, j)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"gdrive/fakedrive"
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/drive/v2"
+)
+
+func TestShare(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+
+	s.AddFile(userA, "a.txt", "", "a")
+	dir := s.AddFolder(userA, "dir", "")
+	s.AddFile(userA, "b.txt", dir.Id, "b")
+	s.AddFile(userB, "not-mine.txt", "", "c")
+
+	if code := gdriver(s, userA, "share", userA, userB); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+
+	for _, f := range s.Files(userA) {
+		shared := false
+		for _, p := range f.Permissions {
+			if p.EmailAddress == userB && p.Role == "reader" {
+				shared = true
+			}
+		}
+		if !shared {
+			t.Errorf("%s is not shared with %s", f.Title, userB)
+		}
+	}
+	if n := s.Calls("drive.permissions.insert"); n != 3 {
+		t.Errorf("%d permissions inserted, want 3", n)
+	}
+}
+
+func TestShareFailure(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+
+	a := s.AddFile(userA, "a.txt", "", "a")
+	b := s.AddFile(userA, "b.txt", "", "b")
+	s.AddFault(fakedrive.Fault{Op: "drive.permissions.insert", Code: http.StatusBadRequest, Reason: "invalid", Times: 1})
+
+	// The other file is shared anyway
+	if code := gdriver(s, userA, "share", "--workers", "2", userA, userB); code != exitPartial {
+		t.Fatalf("exit code %d, want %d", code, exitPartial)
+	}
+	_, sharedA := grantees(s.File(a.Id))[userB]
+	_, sharedB := grantees(s.File(b.Id))[userB]
+	if sharedA == sharedB {
+		t.Errorf("a.txt shared %v, b.txt shared %v, want one of them", sharedA, sharedB)
+	}
+
+	s.AddFault(fakedrive.Fault{Op: "drive.permissions.insert", Code: http.StatusInternalServerError, Reason: "backendError"})
+	if code := gdriver(s, userA, "share", userA, "c@example.com"); code != exitPartial {
+		t.Fatalf("all failed: exit code %d, want %d", code, exitPartial)
+	}
+}
+
+func TestShareRetry(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+
+	s.AddFile(userA, "a.txt", "", "a")
+	s.AddFault(fakedrive.Fault{Op: "drive.permissions.insert", Code: http.StatusForbidden, Reason: "userRateLimitExceeded", Times: 2})
+
+	if code := gdriver(s, userA, "share", userA, userB); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	if n := s.Calls("drive.permissions.insert"); n != 3 {
+		t.Errorf("%d insert calls, want 3", n)
+	}
+}
+
+func TestShareOptions(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+
+	a := s.AddFile(userA, "a.txt", "", "a")
+
+	if code := gdriver(s, userA, "share", "--role", "writer", "--notify", "--message", "Handover", userA, userB, "c@example.com"); code != exitOK {
+		t.Fatalf("writers: exit code %d", code)
+	}
+	if code := gdriver(s, userA, "share", "--role", "commenter", "--type", "group", userA, "team@example.com"); code != exitOK {
+		t.Fatalf("group: exit code %d", code)
+	}
+	if code := gdriver(s, userA, "share", "--type", "anyone", "--with-link", userA); code != exitOK {
+		t.Fatalf("anyone: exit code %d", code)
+	}
+
+	perms := map[string]*drive.Permission{}
+	for _, p := range s.File(a.Id).Permissions {
+		perms[p.Id] = p
+	}
+	for _, email := range []string{userB, "c@example.com"} {
+		if p := perms[fakedrive.PermissionID(email)]; p == nil || p.Role != "writer" {
+			t.Errorf("%s is not a writer: %+v", email, p)
+		}
+	}
+	if p := perms[fakedrive.PermissionID("team@example.com")]; p == nil || p.Type != "group" || p.Role != "reader" ||
+		len(p.AdditionalRoles) != 1 || p.AdditionalRoles[0] != "commenter" {
+		t.Errorf("group is not a commenter: %+v", p)
+	}
+	if p := perms["anyoneWithLink"]; p == nil || p.Role != "reader" {
+		t.Errorf("no reader link for anyone: %+v", p)
+	}
+
+	emails := s.Notifications()
+	if len(emails) != 2 || emails[0].Message != "Handover" {
+		t.Errorf("notifications %+v, want 2 with the message", emails)
+	}
+}
+
+func TestShareInvalid(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+
+	for _, args := range [][]string{
+		{"share", "--role", "owner", userA, userB},
+		{"share", "--type", "robot", userA, userB},
+		{"share", "--type", "anyone", userA, userB},
+		{"share", "--with-link", userA, userB},
+	} {
+		if code := gdriver(s, userA, args...); code != exitUsage {
+			t.Errorf("%v: exit code %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestShareIdempotent(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+
+	reader := s.AddFile(userA, "reader.txt", "", "a")
+	writer := s.AddFile(userA, "writer.txt", "", "b")
+	s.AddFile(userA, "new.txt", "", "c")
+	s.Share(reader.Id, userB, "reader")
+	s.Share(writer.Id, userB, "writer")
+
+	if code := gdriver(s, userA, "share", "--role", "commenter", userA, userB); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	if n := s.Calls("drive.permissions.insert"); n != 1 {
+		t.Errorf("%d permissions inserted, want 1", n)
+	}
+	if n := s.Calls("drive.permissions.patch"); n != 1 {
+		t.Errorf("%d permissions patched, want 1", n)
+	}
+	if n := s.Calls("drive.permissions.getIdForEmail"); n != 1 {
+		t.Errorf("%d permission ID lookups, want 1", n)
+	}
+
+	for _, f := range s.Files(userA) {
+		for _, p := range f.Permissions {
+			if p.EmailAddress != userB {
+				continue
+			}
+			want := "commenter"
+			if f.Id == writer.Id {
+				want = "writer"
+			}
+			got := p.Role
+			if len(p.AdditionalRoles) > 0 {
+				got = p.AdditionalRoles[0]
+			}
+			if got != want {
+				t.Errorf("%s: %s is %s, want %s", f.Title, userB, got, want)
+			}
+		}
+	}
+
+	// Nothing left to do
+	if code := gdriver(s, userA, "share", "--role", "commenter", userA, userB); code != exitOK {
+		t.Fatalf("second run: exit code %d", code)
+	}
+	if n := s.Calls("drive.permissions.insert") + s.Calls("drive.permissions.patch"); n != 2 {
+		t.Errorf("second run changed permissions")
+	}
+}
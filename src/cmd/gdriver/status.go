@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func status(mp *migrationPlan, list string) {
+	counts := mp.Counts()
+	var total, done int64
+	files := mp.Files()
+	for _, item := range files {
+		total += item.Size
+		if item.State == stateCopied || item.State == stateVerified {
+			done += item.Size
+		}
+	}
+
+	fmt.Printf("Migration of %s to folder %s\n", mp.Account, mp.Root)
+	fmt.Printf("%d files: %d pending, %d copying, %d copied, %d verified, %d failed\n", len(files),
+		counts[statePending], counts[stateCopying], counts[stateCopied], counts[stateVerified], counts[stateFailed])
+	fmt.Printf("%d of %d bytes copied\n", done, total)
+
+	if list == "" {
+		return
+	}
+	fmt.Printf("\n")
+	for _, item := range files {
+		if item.State != list {
+			continue
+		}
+		if item.Error != "" {
+			fmt.Printf("%s (%s): %s\n", item.Path, item.SourceID, item.Error)
+		} else {
+			fmt.Printf("%s (%s)\n", item.Path, item.SourceID)
+		}
+	}
+}
+
+func runStatus(fs *flag.FlagSet, args []string) error {
+	list := fs.String("list", stateFailed, "list the files in the `state`: pending, copying, copied, verified or failed, none for no list")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	switch *list {
+	case statePending, stateCopying, stateCopied, stateVerified, stateFailed:
+	case "none":
+		*list = ""
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown state %q\n\n", *list)
+		fs.Usage()
+		return errUsage
+	}
+
+	mp, err := readMigrationPlan()
+	if err != nil {
+		return err
+	}
+	status(mp, *list)
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"gdrive/fakedrive"
+	"net/http"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+
+	if code := gdriver(s, userB, "status"); code != exitFailure {
+		t.Fatalf("without a plan: exit code %d, want %d", code, exitFailure)
+	}
+	if code := gdriver(s, userB, "prepare", userA); code != exitOK {
+		t.Fatalf("prepare exit code %d", code)
+	}
+	s.AddFault(fakedrive.Fault{Op: "drive.files.copy", Code: http.StatusBadRequest, Reason: "invalid", Times: 1})
+	if code := gdriver(s, userB, "migrate", userA); code != exitPartial {
+		t.Fatalf("migrate exit code %d, want %d", code, exitPartial)
+	}
+
+	mp, err := readMigrationPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := mp.Counts(); c[stateCopied] != 1 || c[stateFailed] != 1 {
+		t.Fatalf("states after a failed copy: %v", c)
+	}
+	for _, list := range []string{"failed", "pending", "none"} {
+		if code := gdriver(s, userB, "status", "--list", list); code != exitOK {
+			t.Errorf("--list %s: exit code %d", list, code)
+		}
+	}
+	if code := gdriver(s, userB, "status", "--list", "done"); code != exitUsage {
+		t.Errorf("unknown state: exit code %d, want %d", code, exitUsage)
+	}
+
+	// Only the failed file is copied again
+	copies := s.Calls("drive.files.copy")
+	if code := gdriver(s, userB, "migrate", userA); code != exitOK {
+		t.Fatalf("second migrate exit code %d", code)
+	}
+	if n := s.Calls("drive.files.copy") - copies; n != 1 {
+		t.Errorf("%d copies on the second migrate, want 1", n)
+	}
+	if mp, err = readMigrationPlan(); err != nil {
+		t.Fatal(err)
+	}
+	if c := mp.Counts(); c[stateCopied] != 2 {
+		t.Errorf("states after the second migrate: %v", c)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cheggaaa/pb"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// Outcomes of ownership transfers in the transfer state file
+const (
+	shareTransferred = "transferred"
+	shareWriterLeft  = "transferred-writer-left" // removing the previous owner failed
+)
+
+// transferFile makes the new owner the owner of the file. Drive keeps
+// the previous owner as writer, unless keepWriter is false.
+func transferFile(srv *drive.Service, file *drive.File, perms []*drive.Permission, to grantee, from string, keepWriter bool) (*journalEntry, error) {
+	e := &journalEntry{
+		FileID:  file.Id,
+		Title:   file.Title,
+		Type:    "user",
+		Value:   to.Value,
+		Role:    "owner",
+		Outcome: shareTransferred,
+	}
+
+	var existing, previous *drive.Permission
+	for _, p := range perms {
+		switch {
+		case to.Match(p):
+			existing = p
+		case p.Role == "owner" && strings.EqualFold(permissionValue(p), from):
+			previous = p
+		}
+	}
+
+	var err error
+	if existing != nil {
+		e.PermissionID = existing.Id
+		e.PreviousRole = roleName(existing)
+		patch := rolePermission(&drive.Permission{}, "owner")
+		err = retry(func() error {
+			_, err := srv.Permissions.Patch(file.Id, existing.Id, patch).TransferOwnership(true).Context(ctx).Do()
+			return err
+		})
+	} else {
+		p := &drive.Permission{Type: "user", Value: to.Value, Role: "owner"}
+		err = retry(func() error {
+			inserted, err := srv.Permissions.Insert(file.Id, p).Context(ctx).Do()
+			if err == nil {
+				e.PermissionID = inserted.Id
+			}
+			return err
+		})
+	}
+
+	if err != nil {
+		e.Outcome = shareFailed
+	} else if !keepWriter && previous != nil {
+		if err = removeWriter(srv, file.Id, previous.Id); err != nil {
+			e.Outcome = shareWriterLeft
+			err = fmt.Errorf("transferred, but removing %s failed: %v", from, err)
+		}
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+		fmt.Printf("Transferring %s to %s\n", file.Title, to.Value)
+		fmt.Printf("transferFile: %s\n", err.Error())
+	}
+	return e, err
+}
+
+// removeWriter deletes the permission the previous owner kept.
+func removeWriter(srv *drive.Service, fileID, permissionID string) error {
+	err := retry(func() error {
+		return srv.Permissions.Delete(fileID, permissionID).Context(ctx).Do()
+	})
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// finishTransfers removes the previous owner from the files whose
+// transfer left them as writer. Those files aren't owned by from any
+// more, so only the state file knows them.
+func finishTransfers(srv *drive.Service, left []*journalEntry, from string, state *journal) (int, error) {
+	var id *drive.PermissionId
+	err := retry(func() (err error) {
+		id, err = srv.Permissions.GetIdForEmail(from).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for _, e := range left {
+		if interrupted() {
+			break
+		}
+		done := *e
+		done.Time = time.Time{}
+		done.Outcome = shareTransferred
+		done.Error = ""
+		if err := removeWriter(srv, e.FileID, id.Id); err != nil {
+			fmt.Printf("transferFile: %s: removing %s failed: %v\n", e.Title, from, err)
+			done.Outcome = shareWriterLeft
+			done.Error = err.Error()
+			failed++
+		}
+		if err := state.Write(&done); err != nil {
+			return failed, err
+		}
+	}
+	return failed, nil
+}
+
+// transferred returns the IDs of files the state file records as done
+// and the latest entries of files whose previous owner is left.
+func transferred(stateFile string) (map[string]bool, []*journalEntry, error) {
+	done := map[string]bool{}
+	entries, err := readJournal(stateFile)
+	if os.IsNotExist(err) {
+		return done, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	last := map[string]*journalEntry{}
+	for _, e := range entries {
+		if e.Outcome == shareTransferred || e.Outcome == shareWriterLeft {
+			done[e.FileID] = true
+			last[e.FileID] = e
+		}
+	}
+	var left []*journalEntry
+	for _, e := range entries {
+		if last[e.FileID] == e && e.Outcome == shareWriterLeft {
+			left = append(left, e)
+		}
+	}
+	return done, left, nil
+}
+
+func transfer(srv *drive.Service, from, to string, sc *scope, keepWriter bool, stateFile string) error {
+	done, left, err := transferred(stateFile)
+	if err != nil {
+		return err
+	}
+
+	gs, err := lookupGrantees(srv, []string{to}, &shareOptions{Type: "user"})
+	if err != nil {
+		return err
+	}
+
+	files, err := sc.files(srv, from)
+	if err != nil {
+		return err
+	}
+	var todo []*drive.File
+	for _, f := range files {
+		if !done[f.Id] {
+			todo = append(todo, f)
+		}
+	}
+	fmt.Printf("Found: %d files or directories, %d already transferred\n", len(files), len(files)-len(todo))
+
+	state, err := openJournal(stateFile)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	leftFailed := 0
+	if !keepWriter && len(left) > 0 {
+		fmt.Printf("Removing %s from %d files transferred before\n", from, len(left))
+		if leftFailed, err = finishTransfers(srv, left, from, state); err != nil {
+			return err
+		}
+	}
+
+	// Progress bar
+	bar := pb.New(len(todo))
+	bar.SetRefreshRate(time.Second)
+	bar.Start()
+
+	failed := 0
+	for _, f := range todo {
+		if interrupted() {
+			break
+		}
+		bar.Increment()
+		perms, err := filePermissions(srv, f)
+		var e *journalEntry
+		if err == nil {
+			e, err = transferFile(srv, f, perms, gs[0], from, keepWriter)
+		} else {
+			e = &journalEntry{FileID: f.Id, Title: f.Title, Outcome: shareFailed, Error: err.Error()}
+			fmt.Printf("transferFile: %s: %s\n", f.Title, err.Error())
+		}
+		if jerr := state.Write(e); jerr != nil {
+			return jerr
+		}
+		if err != nil {
+			failed++
+		}
+	}
+	bar.FinishPrint("Done.")
+
+	fmt.Printf("Transferred %d, failed %d\n", len(todo)-failed, failed)
+	if leftFailed > 0 {
+		fmt.Printf("%s is still writer of %d files, run the command again\n", from, leftFailed)
+	}
+	if failed+leftFailed > 0 {
+		return &partialError{Failed: failed + leftFailed, Total: len(todo) + len(left)}
+	}
+	return nil
+}
+
+func runTransfer(fs *flag.FlagSet, args []string) error {
+	keepWriter := fs.Bool("keep-writer", true, "keep the previous owner as writer")
+	stateFile := fs.String("state", "", "state `file` to resume from (default transfer-FROM-TO.jsonl)")
+	sc := &scope{}
+	sc.flags(fs)
+	args, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	from, to := args[0], args[1]
+	if err := sc.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n", err)
+		fs.Usage()
+		return errUsage
+	}
+	if *stateFile == "" {
+		*stateFile = fmt.Sprintf("transfer-%s-%s.jsonl", from, to)
+	}
+
+	srv, err := newService()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Transferring ownership of files owned by %s to %s", from, to)
+	log.Printf("State: %s", *stateFile)
+
+	return transfer(srv, from, to, sc, *keepWriter, *stateFile)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"gdrive/fakedrive"
+	"net/http"
+	"testing"
+)
+
+func TestTransfer(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	projects, _ := fixture(s)
+	// Not shared to userB, the owner permission is inserted
+	notes := s.AddFile(userA, "notes.txt", "", "notes")
+	s.AddFault(fakedrive.Fault{Op: "drive.permissions.patch", Code: http.StatusBadRequest, Reason: "invalid", Times: 1})
+
+	if code := gdriver(s, userA, "transfer", "--state", "transfer.jsonl", userA, userB); code != exitPartial {
+		t.Fatalf("exit code %d, want %d", code, exitPartial)
+	}
+	if n := len(s.Files(userA)); n != 1 {
+		t.Errorf("%d files left owned by %s, want 1", n, userA)
+	}
+	if r := grantees(s.File(notes.Id)); r[userB] != "owner" || r[userA] != "writer" {
+		t.Errorf("notes.txt after transfer: %v", r)
+	}
+
+	// The run resumes with the failed file only
+	patches := s.Calls("drive.permissions.patch")
+	if code := gdriver(s, userA, "transfer", "--state", "transfer.jsonl", userA, userB); code != exitOK {
+		t.Fatalf("resume: exit code %d", code)
+	}
+	if n := s.Calls("drive.permissions.patch") - patches; n != 1 {
+		t.Errorf("%d patch calls on resume, want 1", n)
+	}
+	if n := len(s.Files(userA)); n != 0 {
+		t.Errorf("%d files left owned by %s", n, userA)
+	}
+	if r := grantees(s.File(projects)); r[userB] != "owner" || r[userA] != "writer" {
+		t.Errorf("Projects after transfer: %v", r)
+	}
+}
+
+func TestTransferRemoveWriter(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	a := s.AddFile(userA, "a.txt", "", "a")
+
+	if code := gdriver(s, userA, "transfer", "--keep-writer=false", userA, userB); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	r := grantees(s.File(a.Id))
+	if _, ok := r[userA]; ok || r[userB] != "owner" {
+		t.Errorf("a.txt after transfer: %v", r)
+	}
+}
+
+func TestTransferRemoveWriterFailure(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	a := s.AddFile(userA, "a.txt", "", "a")
+	s.AddFault(fakedrive.Fault{Op: "drive.permissions.delete", Code: http.StatusBadRequest, Reason: "invalid", Times: 1})
+
+	args := []string{"transfer", "--keep-writer=false", "--state", "transfer.jsonl", userA, userB}
+	if code := gdriver(s, userA, args...); code != exitPartial {
+		t.Fatalf("exit code %d, want %d", code, exitPartial)
+	}
+	if r := grantees(s.File(a.Id)); r[userA] != "writer" || r[userB] != "owner" {
+		t.Fatalf("a.txt after the failed removal: %v", r)
+	}
+
+	// a.txt isn't owned by userA any more, the state file finishes it
+	if code := gdriver(s, userA, args...); code != exitOK {
+		t.Fatalf("resume: exit code %d", code)
+	}
+	r := grantees(s.File(a.Id))
+	if _, ok := r[userA]; ok || r[userB] != "owner" {
+		t.Errorf("a.txt after resume: %v", r)
+	}
+	if code := gdriver(s, userA, "rollback", "transfer.jsonl"); code != exitPartial {
+		t.Errorf("rollback of transfers: exit code %d, want %d", code, exitPartial)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/cheggaaa/pb"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// removed is a permission deleted by unshare.
+type removed struct {
+	File *drive.File
+	Perm *drive.Permission
+}
+
+// permissionMatcher returns a function selecting the permissions of
+// the grantee. Users and groups are matched by the permission ID Drive
+// assigns to the email, domains by name.
+func permissionMatcher(srv *drive.Service, granteeType, grantee string) (func(p *drive.Permission) bool, error) {
+	switch granteeType {
+	case "user", "group":
+		var id *drive.PermissionId
+		err := retry(func() (err error) {
+			id, err = srv.Permissions.GetIdForEmail(grantee).Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return func(p *drive.Permission) bool {
+			return p.Id == id.Id
+		}, nil
+	case "domain":
+		return func(p *drive.Permission) bool {
+			return p.Type == "domain" && p.Domain == grantee
+		}, nil
+	case "anyone":
+		return func(p *drive.Permission) bool {
+			return p.Type == "anyone"
+		}, nil
+	}
+	return nil, fmt.Errorf("Unknown grantee type %q", granteeType)
+}
+
+func unshareFile(srv *drive.Service, file *drive.File, match func(p *drive.Permission) bool) ([]removed, error) {
+	var list *drive.PermissionList
+	err := retry(func() (err error) {
+		list, err = srv.Permissions.List(file.Id).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		fmt.Printf("unshareFile: %s: %s\n", file.Title, err.Error())
+		return nil, err
+	}
+
+	var done []removed
+	for _, p := range list.Items {
+		if !match(p) || p.Role == "owner" {
+			continue
+		}
+		err := retry(func() error {
+			return srv.Permissions.Delete(file.Id, p.Id).Context(ctx).Do()
+		})
+		if err != nil {
+			fmt.Printf("Unsharing %s from %s\n", file.Title, p.Id)
+			fmt.Printf("unshareFile: %s\n", err.Error())
+			return done, err
+		}
+		done = append(done, removed{File: file, Perm: p})
+	}
+	return done, nil
+}
+
+// unshare removes the matching permissions from the files. A failed
+// file does not stop the others, failures are listed at the end.
+func unshare(srv *drive.Service, files []*drive.File, match func(p *drive.Permission) bool) error {
+	fmt.Printf("Found: %d files or directories\n", len(files))
+
+	// Progress bar
+	bar := pb.New(len(files))
+	bar.SetRefreshRate(time.Second)
+	bar.Start()
+
+	var all []removed
+	errs := make([]error, len(files))
+	for i, file := range files {
+		if interrupted() {
+			break
+		}
+		bar.Increment()
+		done, err := unshareFile(srv, file, match)
+		all = append(all, done...)
+		errs[i] = err
+	}
+	bar.FinishPrint("Done.")
+
+	for _, r := range all {
+		fmt.Printf("Removed %s %s from %s (%s)\n", r.Perm.Role, permissionGrantee(r.Perm), r.File.Title, r.File.Id)
+	}
+
+	failed := 0
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if failed == 0 {
+			fmt.Printf("Failed:\n")
+		}
+		fmt.Printf("  %s (%s): %v\n", files[i].Title, files[i].Id, err)
+		failed++
+	}
+	fmt.Printf("Removed %d permissions, failed %d files\n", len(all), failed)
+
+	if failed > 0 {
+		return &partialError{Failed: failed, Total: len(files)}
+	}
+	return nil
+}
+
+// permissionGrantee describes who a permission is granted to.
+func permissionGrantee(p *drive.Permission) string {
+	switch p.Type {
+	case "domain":
+		return "domain " + p.Domain
+	case "anyone":
+		if p.WithLink {
+			return "anyone with the link"
+		}
+		return "anyone"
+	}
+	if p.EmailAddress != "" {
+		return p.EmailAddress
+	}
+	return p.Id
+}
+
+func runUnshare(fs *flag.FlagSet, args []string) error {
+	granteeType := fs.String("type", "user", "grantee `type`: user, group, domain or anyone")
+	sc := &scope{}
+	sc.flags(fs)
+	args, err := parseArgsMin(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	err = sc.validate()
+	switch {
+	case err != nil:
+	case *granteeType == "anyone" && len(args) != 1:
+		err = fmt.Errorf("Grantees can't be given with type anyone")
+	case *granteeType != "anyone" && len(args) != 2:
+		err = fmt.Errorf("Give one %s to unshare from", *granteeType)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n", err)
+		fs.Usage()
+		return errUsage
+	}
+	accountFrom, grantee := args[0], "anyone"
+	if len(args) > 1 {
+		grantee = args[1]
+	}
+
+	srv, err := newService()
+	if err != nil {
+		return err
+	}
+
+	match, err := permissionMatcher(srv, *granteeType, grantee)
+	if err != nil {
+		return err
+	}
+
+	files, err := sc.files(srv, accountFrom)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Unsharing files owned by %s from %s", accountFrom, grantee)
+
+	return unshare(srv, files, match)
+}
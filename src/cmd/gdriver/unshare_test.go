@@ -0,0 +1,112 @@
+package main
+
+import (
+	"gdrive/fakedrive"
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// grantees returns the emails, domains or "anyone" file is shared with.
+func grantees(f *drive.File) map[string]string {
+	m := map[string]string{}
+	for _, p := range f.Permissions {
+		switch p.Type {
+		case "domain":
+			m[p.Domain] = p.Role
+		case "anyone":
+			m["anyone"] = p.Role
+		default:
+			m[p.EmailAddress] = p.Role
+		}
+	}
+	return m
+}
+
+func TestUnshare(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	other := s.AddFile(userA, "other.txt", "", "other")
+	s.Share(other.Id, "c@example.com", "writer")
+
+	if code := gdriver(s, userA, "unshare", userA, userB); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+
+	for _, f := range s.Files(userA) {
+		if role, ok := grantees(f)[userB]; ok {
+			t.Errorf("%s still shared with %s as %s", f.Title, userB, role)
+		}
+	}
+	if grantees(s.File(other.Id))["c@example.com"] != "writer" {
+		t.Error("permission of another user removed")
+	}
+	if n := s.Calls("drive.permissions.delete"); n != 5 {
+		t.Errorf("%d permissions deleted, want 5", n)
+	}
+}
+
+func TestUnshareFolder(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	_, acme := fixture(s)
+
+	if code := gdriver(s, userA, "unshare", "--folder", acme, userA, userB); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+
+	for _, f := range s.Files(userA) {
+		_, shared := grantees(f)[userB]
+		inACME := f.Title == "ACME" || f.Title == "spec.txt" || f.Title == "Docs"
+		if shared == inACME {
+			t.Errorf("%s shared %v after unsharing ACME", f.Title, shared)
+		}
+	}
+}
+
+func TestUnshareAnyone(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	if code := gdriver(s, userA, "share", "--type", "anyone", userA); code != exitOK {
+		t.Fatalf("share exit code %d", code)
+	}
+
+	if code := gdriver(s, userA, "unshare", "--type", "anyone", userA, "x"); code != exitUsage {
+		t.Errorf("grantee with type anyone: exit code %d, want %d", code, exitUsage)
+	}
+	if code := gdriver(s, userA, "unshare", userA); code != exitUsage {
+		t.Errorf("no grantee: exit code %d, want %d", code, exitUsage)
+	}
+	if code := gdriver(s, userA, "unshare", "--type", "anyone", userA); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	for _, f := range s.Files(userA) {
+		if _, ok := grantees(f)["anyone"]; ok {
+			t.Errorf("%s still shared with anyone", f.Title)
+		}
+	}
+}
+
+func TestUnshareFailure(t *testing.T) {
+	s, done := setup(t)
+	defer done()
+	fixture(s)
+	s.AddFault(fakedrive.Fault{Op: "drive.permissions.delete", Code: http.StatusBadRequest, Reason: "invalid", Times: 1})
+
+	// The other files are unshared anyway
+	if code := gdriver(s, userA, "unshare", userA, userB); code != exitPartial {
+		t.Fatalf("exit code %d, want %d", code, exitPartial)
+	}
+	shared := 0
+	for _, f := range s.Files(userA) {
+		if _, ok := grantees(f)[userB]; ok {
+			shared++
+		}
+	}
+	if shared != 1 {
+		t.Errorf("%d files still shared, want 1", shared)
+	}
+}
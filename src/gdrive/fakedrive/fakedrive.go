@@ -0,0 +1,852 @@
+// Package fakedrive implements an in-memory Drive v2 server for tests.
+//
+// It serves the subset of the API used by gdriver: listing with
+// owner/parent queries and paging, files get/insert/copy, children
+// and permissions. Requests are made on behalf of the user named by
+// the bearer token, so several accounts can share one server.
+package fakedrive
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gdrive"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/drive/v2"
+)
+
+const (
+	apiPath    = "/drive/v2/"
+	dateFormat = "2006-01-02T15:04:05.000Z"
+)
+
+// Roles in ascending order of privileges.
+const (
+	roleNone = iota
+	roleReader
+	roleCommenter
+	roleWriter
+	roleOwner
+)
+
+// Fault makes matching requests fail or slow down.
+type Fault struct {
+	// Op is the API method, e.g. "drive.files.copy". Empty matches all.
+	Op string
+	// Code is the HTTP status to return, 0 only applies Delay.
+	Code int
+	// Reason is the googleapi error reason, e.g. "rateLimitExceeded".
+	Reason string
+	// RetryAfter is sent as the Retry-After header when set.
+	RetryAfter string
+	// Delay is applied before the request is served.
+	Delay time.Duration
+	// Times is the number of requests affected, 0 means all.
+	Times int
+	// After serves the request before failing it, as if the response
+	// was lost.
+	After bool
+}
+
+// Notification is an email Drive sent about a new permission.
+type Notification struct {
+	FileID  string
+	To      string
+	Message string
+}
+
+// Server is a fake Drive v2 API server.
+type Server struct {
+	*httptest.Server
+
+	// PageSize, when set, returns list pages with at most PageSize
+	// items regardless of maxResults.
+	PageSize int
+
+	// OmitListPermissions, when set, lists files without their
+	// permissions, so clients have to list them per file.
+	OmitListPermissions bool
+
+	mu     sync.Mutex
+	files  map[string]*drive.File
+	order  []string          // file IDs in creation order
+	roots  map[string]string // user -> root folder ID
+	nextID int
+	clock  time.Time
+	faults []*Fault
+	calls  map[string]int
+	emails []Notification
+}
+
+type apiError struct {
+	Code    int
+	Reason  string
+	Message string
+}
+
+// NewServer starts a new empty server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		files: map[string]*drive.File{},
+		roots: map[string]string{},
+		clock: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC),
+		calls: map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// BasePath is the API endpoint for drive.Service.BasePath.
+func (s *Server) BasePath() string {
+	return s.URL + apiPath
+}
+
+// Options returns gdrive.NewService options for talking to the
+// server as user.
+func (s *Server) Options(user string) []gdrive.Option {
+	return []gdrive.Option{
+		gdrive.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: user})),
+		gdrive.WithBasePath(s.BasePath()),
+	}
+}
+
+// Service returns a Drive service acting as user.
+func (s *Server) Service(user string) (*drive.Service, error) {
+	return gdrive.NewService(context.Background(), s.Options(user)...)
+}
+
+// AddFault registers a fault for subsequent requests.
+func (s *Server) AddFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// Calls returns how many times the API method op was called.
+func (s *Server) Calls(op string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[op]
+}
+
+// Notifications returns the emails sent about new permissions.
+func (s *Server) Notifications() []Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Notification(nil), s.emails...)
+}
+
+// Root returns the ID of the user's root folder.
+func (s *Server) Root(user string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.root(user)
+}
+
+// AddFolder creates a folder owned by owner. An empty parent means
+// the owner's root folder.
+func (s *Server) AddFolder(owner, title, parent string) *drive.File {
+	return s.add(owner, &drive.File{Title: title, MimeType: gdrive.FolderMIME}, parent)
+}
+
+// AddFile creates a binary file with the given content.
+func (s *Server) AddFile(owner, title, parent, content string) *drive.File {
+	sum := md5.Sum([]byte(content))
+	f := &drive.File{
+		Title:          title,
+		MimeType:       "application/octet-stream",
+		Md5Checksum:    hex.EncodeToString(sum[:]),
+		FileSize:       int64(len(content)),
+		QuotaBytesUsed: int64(len(content)),
+		Copyable:       true,
+	}
+	return s.add(owner, f, parent)
+}
+
+func (s *Server) add(owner string, f *drive.File, parent string) *drive.File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if parent == "" {
+		parent = s.root(owner)
+	}
+	f.Parents = []*drive.ParentReference{{Id: parent}}
+	return s.export(s.create(owner, f))
+}
+
+// Update modifies a stored file in place.
+func (s *Server) Update(id string, fn func(f *drive.File)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.files[id])
+}
+
+// Share grants role on the file to a user.
+func (s *Server) Share(id, email, role string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setPermission(s.files[id], &drive.Permission{Type: "user", Role: role, Value: email})
+}
+
+// File returns a copy of the stored file, or nil.
+func (s *Server) File(id string) *drive.File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[id]
+	if !ok {
+		return nil
+	}
+	return s.export(f)
+}
+
+// Files returns copies of all files owned by owner in creation order.
+func (s *Server) Files(owner string) []*drive.File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var fs []*drive.File
+	for _, id := range s.order {
+		f := s.files[id]
+		if isOwner(f, owner) && !s.isRoot(id) {
+			fs = append(fs, s.export(f))
+		}
+	}
+	return fs
+}
+
+// PermissionID returns the permission ID Drive uses for an email.
+func PermissionID(email string) string {
+	h := fnv.New64a()
+	h.Write([]byte(strings.ToLower(email)))
+	return strconv.FormatUint(h.Sum64(), 10)
+}
+
+func (s *Server) root(user string) string {
+	if id, ok := s.roots[user]; ok {
+		return id
+	}
+	s.nextID++
+	id := fmt.Sprintf("root%d", s.nextID)
+	s.roots[user] = id
+	s.create(user, &drive.File{Id: id, Title: "My Drive", MimeType: gdrive.FolderMIME})
+	return id
+}
+
+func (s *Server) isRoot(id string) bool {
+	for _, r := range s.roots {
+		if r == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) now() string {
+	s.clock = s.clock.Add(time.Second)
+	return s.clock.Format(dateFormat)
+}
+
+// create stores f owned by owner and assigns an ID if missing.
+func (s *Server) create(owner string, f *drive.File) *drive.File {
+	if f.Id == "" {
+		s.nextID++
+		f.Id = fmt.Sprintf("f%d", s.nextID)
+	}
+	if f.MimeType == "" {
+		f.MimeType = "application/octet-stream"
+	}
+	f.Kind = "drive#file"
+	f.CreatedDate = s.now()
+	if f.ModifiedDate == "" {
+		f.ModifiedDate = f.CreatedDate
+	}
+	f.Labels = &drive.FileLabels{}
+	f.Permissions = nil
+	s.setPermission(f, &drive.Permission{Type: "user", Role: "owner", Value: owner})
+	s.files[f.Id] = f
+	s.order = append(s.order, f.Id)
+	return f
+}
+
+// export returns a deep copy of f as seen through the API.
+func (s *Server) export(f *drive.File) *drive.File {
+	b, err := json.Marshal(f)
+	if err != nil {
+		panic(err)
+	}
+	c := &drive.File{}
+	if err := json.Unmarshal(b, c); err != nil {
+		panic(err)
+	}
+	for _, p := range c.Parents {
+		p.IsRoot = s.isRoot(p.Id)
+	}
+	return c
+}
+
+func roleValue(p *drive.Permission) int {
+	switch p.Role {
+	case "owner":
+		return roleOwner
+	case "writer":
+		return roleWriter
+	case "reader":
+		for _, r := range p.AdditionalRoles {
+			if r == "commenter" {
+				return roleCommenter
+			}
+		}
+		return roleReader
+	}
+	return roleNone
+}
+
+func domainOf(email string) string {
+	return email[strings.LastIndex(email, "@")+1:]
+}
+
+// roleOf returns the highest role the user has on f.
+func roleOf(f *drive.File, user string) int {
+	role := roleNone
+	for _, p := range f.Permissions {
+		match := false
+		switch p.Type {
+		case "user", "group":
+			match = strings.EqualFold(p.EmailAddress, user)
+		case "domain":
+			match = strings.EqualFold(p.Domain, domainOf(user))
+		case "anyone":
+			match = true
+		}
+		if r := roleValue(p); match && r > role {
+			role = r
+		}
+	}
+	return role
+}
+
+func isOwner(f *drive.File, user string) bool {
+	for _, o := range f.Owners {
+		if strings.EqualFold(o.EmailAddress, user) {
+			return true
+		}
+	}
+	return false
+}
+
+// setPermission inserts p or updates the role of an existing
+// permission with the same ID. Inserting an owner transfers the
+// ownership and leaves previous owners as writers.
+func (s *Server) setPermission(f *drive.File, p *drive.Permission) *drive.Permission {
+	np := &drive.Permission{
+		Kind:            "drive#permission",
+		Type:            p.Type,
+		Role:            p.Role,
+		AdditionalRoles: p.AdditionalRoles,
+		WithLink:        p.WithLink,
+	}
+	switch p.Type {
+	case "user", "group":
+		np.Id = PermissionID(p.Value)
+		np.EmailAddress = p.Value
+		np.Name = p.Value
+	case "domain":
+		np.Id = "domain-" + PermissionID(p.Value)
+		np.Domain = p.Value
+		np.Name = p.Value
+	case "anyone":
+		np.Id = "anyone"
+		if p.WithLink {
+			np.Id = "anyoneWithLink"
+		}
+	}
+
+	if np.Role == "owner" {
+		for _, old := range f.Permissions {
+			if old.Role == "owner" {
+				old.Role = "writer"
+			}
+		}
+	}
+
+	for i, old := range f.Permissions {
+		if old.Id == np.Id {
+			f.Permissions[i] = np
+			s.syncOwners(f)
+			return np
+		}
+	}
+	f.Permissions = append(f.Permissions, np)
+	s.syncOwners(f)
+	return np
+}
+
+func (s *Server) syncOwners(f *drive.File) {
+	f.Owners = nil
+	f.OwnerNames = nil
+	for _, p := range f.Permissions {
+		if p.Role == "owner" {
+			f.Owners = append(f.Owners, &drive.User{
+				Kind:         "drive#user",
+				EmailAddress: p.EmailAddress,
+				DisplayName:  p.Name,
+				PermissionId: p.Id,
+			})
+			f.OwnerNames = append(f.OwnerNames, p.Name)
+		}
+	}
+}
+
+// serve dispatches an API request.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, apiPath) {
+		http.NotFound(w, r)
+		return
+	}
+	var segs []string
+	for _, seg := range strings.Split(strings.Trim(path[len(apiPath):], "/"), "/") {
+		seg, err := url.QueryUnescape(seg)
+		if err != nil {
+			writeError(w, &apiError{http.StatusBadRequest, "invalid", err.Error()})
+			return
+		}
+		segs = append(segs, seg)
+	}
+
+	op, handler := s.route(r.Method, segs)
+	if handler == nil {
+		writeError(w, &apiError{http.StatusNotFound, "notFound", "Not Found"})
+		return
+	}
+
+	user := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if user == "" {
+		writeError(w, &apiError{http.StatusUnauthorized, "authError", "Login Required"})
+		return
+	}
+
+	s.mu.Lock()
+	s.calls[op]++
+	fault := s.fault(op)
+	s.mu.Unlock()
+
+	if fault != nil {
+		time.Sleep(fault.Delay)
+		if fault.After {
+			s.mu.Lock()
+			handler(user, r)
+			s.mu.Unlock()
+		}
+		if fault.Code != 0 {
+			if fault.RetryAfter != "" {
+				w.Header().Set("Retry-After", fault.RetryAfter)
+			}
+			writeError(w, &apiError{fault.Code, fault.Reason, http.StatusText(fault.Code)})
+			return
+		}
+	}
+
+	s.mu.Lock()
+	v, e := handler(user, r)
+	s.mu.Unlock()
+
+	if e != nil {
+		writeError(w, e)
+		return
+	}
+	if v == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// fault returns the first matching fault and consumes one of its uses.
+func (s *Server) fault(op string) *Fault {
+	for i, f := range s.faults {
+		if f.Op != "" && f.Op != op {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+type handlerFunc func(user string, r *http.Request) (interface{}, *apiError)
+
+func (s *Server) route(method string, segs []string) (string, handlerFunc) {
+	n := len(segs)
+	switch {
+	case n == 2 && segs[0] == "permissionIds" && method == "GET":
+		return "drive.permissions.getIdForEmail", func(user string, r *http.Request) (interface{}, *apiError) {
+			return &drive.PermissionId{Kind: "drive#permissionId", Id: PermissionID(segs[1])}, nil
+		}
+	case n == 0 || segs[0] != "files":
+		return "", nil
+	case n == 1 && method == "GET":
+		return "drive.files.list", s.listFiles
+	case n == 1 && method == "POST":
+		return "drive.files.insert", s.insertFile
+	case n == 2 && method == "GET":
+		return "drive.files.get", func(user string, r *http.Request) (interface{}, *apiError) {
+			f, e := s.lookup(user, segs[1])
+			if e != nil {
+				return nil, e
+			}
+			return s.export(f), nil
+		}
+	case n == 3 && segs[2] == "copy" && method == "POST":
+		return "drive.files.copy", func(user string, r *http.Request) (interface{}, *apiError) {
+			return s.copyFile(user, segs[1], r)
+		}
+	case n == 3 && segs[2] == "children" && method == "GET":
+		return "drive.children.list", func(user string, r *http.Request) (interface{}, *apiError) {
+			return s.listChildren(user, segs[1], r)
+		}
+	case n == 3 && segs[2] == "permissions" && method == "GET":
+		return "drive.permissions.list", func(user string, r *http.Request) (interface{}, *apiError) {
+			f, e := s.lookup(user, segs[1])
+			if e != nil {
+				return nil, e
+			}
+			return &drive.PermissionList{Kind: "drive#permissionList", Items: s.export(f).Permissions}, nil
+		}
+	case n == 3 && segs[2] == "permissions" && method == "POST":
+		return "drive.permissions.insert", func(user string, r *http.Request) (interface{}, *apiError) {
+			return s.insertPermission(user, segs[1], r)
+		}
+	case n == 4 && segs[2] == "permissions" && method == "GET":
+		return "drive.permissions.get", func(user string, r *http.Request) (interface{}, *apiError) {
+			f, e := s.lookup(user, segs[1])
+			if e != nil {
+				return nil, e
+			}
+			for _, p := range s.export(f).Permissions {
+				if p.Id == segs[3] {
+					return p, nil
+				}
+			}
+			return nil, &apiError{http.StatusNotFound, "notFound", "Permission not found: " + segs[3]}
+		}
+	case n == 4 && segs[2] == "permissions" && (method == "PATCH" || method == "PUT"):
+		return "drive.permissions.patch", func(user string, r *http.Request) (interface{}, *apiError) {
+			return s.patchPermission(user, segs[1], segs[3], r)
+		}
+	case n == 4 && segs[2] == "permissions" && method == "DELETE":
+		return "drive.permissions.delete", func(user string, r *http.Request) (interface{}, *apiError) {
+			return nil, s.deletePermission(user, segs[1], segs[3])
+		}
+	}
+	return "", nil
+}
+
+func writeError(w http.ResponseWriter, e *apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    e.Code,
+			"message": e.Message,
+			"errors": []map[string]string{
+				{"domain": "global", "reason": e.Reason, "message": e.Message},
+			},
+		},
+	})
+}
+
+func notFound(id string) *apiError {
+	return &apiError{http.StatusNotFound, "notFound", "File not found: " + id}
+}
+
+// lookup returns a file visible to the user. "root" is an alias of
+// the user's root folder.
+func (s *Server) lookup(user, id string) (*drive.File, *apiError) {
+	if id == "root" {
+		id = s.root(user)
+	}
+	f, ok := s.files[id]
+	if !ok || roleOf(f, user) == roleNone {
+		return nil, notFound(id)
+	}
+	return f, nil
+}
+
+// writable returns a file the user can modify.
+func (s *Server) writable(user, id string) (*drive.File, *apiError) {
+	f, e := s.lookup(user, id)
+	if e != nil {
+		return nil, e
+	}
+	if roleOf(f, user) < roleWriter {
+		return nil, &apiError{http.StatusForbidden, "insufficientFilePermissions",
+			"The user does not have sufficient permissions for file " + id}
+	}
+	return f, nil
+}
+
+// page applies maxResults, pageToken and PageSize to n items and
+// returns the slice bounds and the next page token.
+func (s *Server) page(r *http.Request, n int) (int, int, string, *apiError) {
+	start := 0
+	if t := r.FormValue("pageToken"); t != "" {
+		var err error
+		start, err = strconv.Atoi(t)
+		if err != nil || start < 0 || start > n {
+			return 0, 0, "", &apiError{http.StatusBadRequest, "invalid", "Invalid page token"}
+		}
+	}
+	size := 100
+	if m := r.FormValue("maxResults"); m != "" {
+		size, _ = strconv.Atoi(m)
+	}
+	if s.PageSize > 0 && s.PageSize < size {
+		size = s.PageSize
+	}
+	end := start + size
+	if end >= n {
+		return start, n, "", nil
+	}
+	return start, end, strconv.Itoa(end), nil
+}
+
+func (s *Server) listFiles(user string, r *http.Request) (interface{}, *apiError) {
+	match := func(f *drive.File) bool { return true }
+	if q := r.FormValue("q"); q != "" {
+		var err error
+		match, err = parseQuery(q)
+		if err != nil {
+			return nil, &apiError{http.StatusBadRequest, "invalid", err.Error()}
+		}
+	}
+
+	var items []*drive.File
+	for _, id := range s.order {
+		f := s.files[id]
+		if s.isRoot(id) || roleOf(f, user) == roleNone || !match(f) {
+			continue
+		}
+		items = append(items, f)
+	}
+
+	start, end, next, e := s.page(r, len(items))
+	if e != nil {
+		return nil, e
+	}
+	l := &drive.FileList{Kind: "drive#fileList", NextPageToken: next}
+	for _, f := range items[start:end] {
+		item := s.export(f)
+		if s.OmitListPermissions {
+			item.Permissions = nil
+		}
+		l.Items = append(l.Items, item)
+	}
+	return l, nil
+}
+
+func (s *Server) listChildren(user, id string, r *http.Request) (interface{}, *apiError) {
+	folder, e := s.lookup(user, id)
+	if e != nil {
+		return nil, e
+	}
+
+	var items []*drive.ChildReference
+	for _, cid := range s.order {
+		f := s.files[cid]
+		if roleOf(f, user) == roleNone {
+			continue
+		}
+		for _, p := range f.Parents {
+			if p.Id == folder.Id {
+				items = append(items, &drive.ChildReference{Kind: "drive#childReference", Id: cid})
+				break
+			}
+		}
+	}
+
+	start, end, next, e := s.page(r, len(items))
+	if e != nil {
+		return nil, e
+	}
+	return &drive.ChildList{Kind: "drive#childList", Items: items[start:end], NextPageToken: next}, nil
+}
+
+// parents checks the requested parents and defaults to the user's root.
+func (s *Server) parents(user string, refs []*drive.ParentReference) ([]*drive.ParentReference, *apiError) {
+	if len(refs) == 0 {
+		return []*drive.ParentReference{{Id: s.root(user)}}, nil
+	}
+	var ps []*drive.ParentReference
+	for _, p := range refs {
+		f, e := s.writable(user, p.Id)
+		if e != nil {
+			return nil, e
+		}
+		ps = append(ps, &drive.ParentReference{Id: f.Id})
+	}
+	return ps, nil
+}
+
+func decode(r *http.Request, v interface{}) *apiError {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return &apiError{http.StatusBadRequest, "parseError", err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) insertFile(user string, r *http.Request) (interface{}, *apiError) {
+	in := &drive.File{}
+	if e := decode(r, in); e != nil {
+		return nil, e
+	}
+	ps, e := s.parents(user, in.Parents)
+	if e != nil {
+		return nil, e
+	}
+	f := &drive.File{
+		Title:       in.Title,
+		MimeType:    in.MimeType,
+		Description: in.Description,
+		Parents:     ps,
+		Properties:  in.Properties,
+		Copyable:    in.MimeType != gdrive.FolderMIME,
+	}
+	return s.export(s.create(user, f)), nil
+}
+
+func (s *Server) copyFile(user, id string, r *http.Request) (interface{}, *apiError) {
+	src, e := s.lookup(user, id)
+	if e != nil {
+		return nil, e
+	}
+	if !src.Copyable {
+		return nil, &apiError{http.StatusForbidden, "cannotCopyFile", "This file cannot be copied by the user."}
+	}
+	in := &drive.File{}
+	if e := decode(r, in); e != nil {
+		return nil, e
+	}
+	ps, e := s.parents(user, in.Parents)
+	if e != nil {
+		return nil, e
+	}
+	f := &drive.File{
+		Title:          src.Title,
+		MimeType:       src.MimeType,
+		Description:    src.Description,
+		Md5Checksum:    src.Md5Checksum,
+		FileSize:       src.FileSize,
+		QuotaBytesUsed: src.QuotaBytesUsed,
+		Copyable:       true,
+		Parents:        ps,
+		Properties:     in.Properties,
+	}
+	if in.Title != "" {
+		f.Title = in.Title
+	}
+	return s.export(s.create(user, f)), nil
+}
+
+func (s *Server) insertPermission(user, id string, r *http.Request) (interface{}, *apiError) {
+	f, e := s.writable(user, id)
+	if e != nil {
+		return nil, e
+	}
+	p := &drive.Permission{}
+	if e := decode(r, p); e != nil {
+		return nil, e
+	}
+	switch {
+	case p.Type == "anyone":
+	case p.Value == "":
+		return nil, &apiError{http.StatusBadRequest, "required", "Permission value required"}
+	case p.Type != "user" && p.Type != "group" && p.Type != "domain":
+		return nil, &apiError{http.StatusBadRequest, "invalid", "Invalid permission type: " + p.Type}
+	}
+	if roleValue(p) == roleNone {
+		return nil, &apiError{http.StatusBadRequest, "invalid", "Invalid permission role: " + p.Role}
+	}
+	if p.Role == "owner" && roleOf(f, user) < roleOwner {
+		return nil, &apiError{http.StatusForbidden, "insufficientFilePermissions", "Only the owner can transfer ownership"}
+	}
+	f.ModifiedDate = s.now()
+	// Users and groups are notified unless disabled
+	if (p.Type == "user" || p.Type == "group") && r.FormValue("sendNotificationEmails") != "false" {
+		s.emails = append(s.emails, Notification{FileID: f.Id, To: p.Value, Message: r.FormValue("emailMessage")})
+	}
+	return s.setPermission(f, p), nil
+}
+
+func (s *Server) patchPermission(user, id, pid string, r *http.Request) (interface{}, *apiError) {
+	f, e := s.writable(user, id)
+	if e != nil {
+		return nil, e
+	}
+	in := &drive.Permission{}
+	if e := decode(r, in); e != nil {
+		return nil, e
+	}
+	for _, p := range f.Permissions {
+		if p.Id != pid {
+			continue
+		}
+		np := *p
+		np.Role = in.Role
+		np.AdditionalRoles = in.AdditionalRoles
+		if roleValue(&np) == roleNone {
+			return nil, &apiError{http.StatusBadRequest, "invalid", "Invalid permission role: " + in.Role}
+		}
+		if np.Role == "owner" {
+			if roleOf(f, user) < roleOwner {
+				return nil, &apiError{http.StatusForbidden, "insufficientFilePermissions", "Only the owner can transfer ownership"}
+			}
+			if r.FormValue("transferOwnership") != "true" {
+				return nil, &apiError{http.StatusBadRequest, "transferOwnershipRequired", "transferOwnership must be set to make this change"}
+			}
+		}
+		if p.Role == "owner" && np.Role != "owner" {
+			return nil, &apiError{http.StatusForbidden, "cannotModifyOwner", "The owner's role cannot be changed."}
+		}
+		np.Value = np.EmailAddress
+		if np.Type == "domain" {
+			np.Value = np.Domain
+		}
+		f.ModifiedDate = s.now()
+		return s.setPermission(f, &np), nil
+	}
+	return nil, &apiError{http.StatusNotFound, "notFound", "Permission not found: " + pid}
+}
+
+func (s *Server) deletePermission(user, id, pid string) *apiError {
+	f, e := s.writable(user, id)
+	if e != nil {
+		return e
+	}
+	for i, p := range f.Permissions {
+		if p.Id != pid {
+			continue
+		}
+		if p.Role == "owner" {
+			return &apiError{http.StatusForbidden, "cannotRemoveOwner", "The owner of a file cannot be removed."}
+		}
+		f.Permissions = append(f.Permissions[:i], f.Permissions[i+1:]...)
+		return nil
+	}
+	return &apiError{http.StatusNotFound, "notFound", "Permission not found: " + pid}
+}
@@ -0,0 +1,147 @@
+package fakedrive
+
+import (
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/drive/v2"
+	"google.golang.org/api/googleapi"
+)
+
+func TestListOwnersPaging(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.PageSize = 2
+
+	dir := s.AddFolder("a@example.com", "dir", "")
+	for _, title := range []string{"1", "2", "3", "4", "5"} {
+		s.AddFile("a@example.com", title, dir.Id, title)
+	}
+	s.AddFile("b@example.com", "other", "", "x")
+
+	srv, err := s.Service("a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, pages := 0, 0
+	q := srv.Files.List().Q("'a@example.com' in owners").MaxResults(1000)
+	for {
+		r, err := q.Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		n += len(r.Items)
+		if r.NextPageToken == "" {
+			break
+		}
+		q.PageToken(r.NextPageToken)
+	}
+	if n != 6 || pages != 3 {
+		t.Errorf("got %d files in %d pages, want 6 in 3", n, pages)
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	f := s.AddFile("a@example.com", "secret", "", "x")
+	srv, err := s.Service("b@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := srv.Files.Get(f.Id).Do(); !isCode(err, http.StatusNotFound) {
+		t.Fatalf("Get before sharing: got %v, want 404", err)
+	}
+
+	s.Share(f.Id, "b@example.com", "reader")
+	if _, err := srv.Files.Get(f.Id).Do(); err != nil {
+		t.Fatalf("Get after sharing: %v", err)
+	}
+
+	if _, err := srv.Files.Copy(f.Id, &drive.File{}).Do(); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if got := len(s.Files("b@example.com")); got != 1 {
+		t.Errorf("b owns %d files after copy, want 1", got)
+	}
+}
+
+func TestFault(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	f := s.AddFile("a@example.com", "f", "", "x")
+	s.AddFault(Fault{Op: "drive.files.get", Code: 429, Reason: "rateLimitExceeded", Times: 1})
+
+	srv, err := s.Service("a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = srv.Files.Get(f.Id).Do()
+	e, ok := err.(*googleapi.Error)
+	if !ok || e.Code != 429 || len(e.Errors) != 1 || e.Errors[0].Reason != "rateLimitExceeded" {
+		t.Fatalf("first Get: got %v, want 429 rateLimitExceeded", err)
+	}
+	if _, err := srv.Files.Get(f.Id).Do(); err != nil {
+		t.Fatalf("second Get: %v", err)
+	}
+	if got := s.Calls("drive.files.get"); got != 2 {
+		t.Errorf("Calls = %d, want 2", got)
+	}
+
+	s.AddFault(Fault{Op: "drive.files.insert", Code: 503, After: true, Times: 1})
+	if _, err := srv.Files.Insert(&drive.File{Title: "g"}).Do(); err == nil {
+		t.Fatal("Insert with a lost response succeeded")
+	}
+	if n := len(s.Files("a@example.com")); n != 2 {
+		t.Errorf("%d files after a lost Insert response, want 2", n)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	for _, tt := range []struct {
+		q    string
+		want bool
+	}{
+		{"'a@example.com' in owners", true},
+		{"'b@example.com' in owners", false},
+		{"title = 'it\\'s' and trashed = false", false},
+		{"title = 'f' and mimeType != 'application/vnd.google-apps.folder'", true},
+		{"title contains 'x'", false},
+		{"modifiedDate > '2014-01-01T00:00:00'", true},
+		{"properties has { key='src' and value='1' and visibility='PRIVATE' }", true},
+		{"(title = 'x' or title = 'f') and 'a@example.com' in owners", true},
+		{"title = 'x' or title = 'y' and trashed = false", false},
+		{"not title contains 'x' and not (trashed = true)", true},
+	} {
+		p, err := parseQuery(tt.q)
+		if err != nil {
+			t.Errorf("%s: %v", tt.q, err)
+			continue
+		}
+		f := &drive.File{
+			Title:        "f",
+			MimeType:     "text/plain",
+			ModifiedDate: "2015-01-01T00:00:00.000Z",
+			Owners:       []*drive.User{{EmailAddress: "a@example.com"}},
+			Properties:   []*drive.Property{{Key: "src", Value: "1", Visibility: "PRIVATE"}},
+		}
+		if got := p(f); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	if _, err := parseQuery("sharedWithMe"); err == nil {
+		t.Error("unsupported query parsed without error")
+	}
+}
+
+func isCode(err error, code int) bool {
+	e, ok := err.(*googleapi.Error)
+	return ok && e.Code == code
+}
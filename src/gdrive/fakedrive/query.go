@@ -0,0 +1,269 @@
+package fakedrive
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/drive/v2"
+)
+
+// predicate reports whether a file matches a query term.
+type predicate func(f *drive.File) bool
+
+// parseQuery understands the subset of the Drive v2 search syntax used
+// by the tools: terms combined with "and", "or", "not" and
+// parentheses, each term one of
+//
+//	'value' in owners|parents|writers|readers
+//	title|mimeType|modifiedDate = 'value'   (also !=, <, <=, >, >=, contains)
+//	trashed = true|false
+//	properties has { key='k' and value='v' and visibility='PRIVATE' }
+func parseQuery(q string) (predicate, error) {
+	toks, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+
+	p, rest, err := parseOr(toks)
+	if err == nil && len(rest) > 0 {
+		err = fmt.Errorf("unexpected %s", rest[0])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid query %q: %v", q, err)
+	}
+	return p, nil
+}
+
+func parseOr(toks []string) (predicate, []string, error) {
+	var preds []predicate
+	for {
+		p, rest, err := parseAnd(toks)
+		if err != nil {
+			return nil, nil, err
+		}
+		preds = append(preds, p)
+		if len(rest) == 0 || rest[0] != "or" {
+			return func(f *drive.File) bool {
+				for _, p := range preds {
+					if p(f) {
+						return true
+					}
+				}
+				return false
+			}, rest, nil
+		}
+		toks = rest[1:]
+	}
+}
+
+func parseAnd(toks []string) (predicate, []string, error) {
+	var preds []predicate
+	for {
+		p, rest, err := parseUnary(toks)
+		if err != nil {
+			return nil, nil, err
+		}
+		preds = append(preds, p)
+		if len(rest) == 0 || rest[0] != "and" {
+			return func(f *drive.File) bool {
+				for _, p := range preds {
+					if !p(f) {
+						return false
+					}
+				}
+				return true
+			}, rest, nil
+		}
+		toks = rest[1:]
+	}
+}
+
+func parseUnary(toks []string) (predicate, []string, error) {
+	switch {
+	case len(toks) == 0:
+		return nil, nil, fmt.Errorf("expected term")
+	case toks[0] == "not":
+		p, rest, err := parseUnary(toks[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		return func(f *drive.File) bool { return !p(f) }, rest, nil
+	case toks[0] == "(":
+		p, rest, err := parseOr(toks[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 || rest[0] != ")" {
+			return nil, nil, fmt.Errorf("expected )")
+		}
+		return p, rest[1:], nil
+	}
+	return parseTerm(toks)
+}
+
+// lex splits the query into words, operators and quoted strings.
+// Quoted strings keep their leading quote to tell them from words.
+func lex(q string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '\'':
+			var b bytes.Buffer
+			b.WriteByte('\'')
+			i++
+			for ; i < len(q) && q[i] != '\''; i++ {
+				if q[i] == '\\' && i+1 < len(q) {
+					i++
+				}
+				b.WriteByte(q[i])
+			}
+			if i >= len(q) {
+				return nil, fmt.Errorf("unterminated string in %q", q)
+			}
+			i++
+			toks = append(toks, b.String())
+		case c == '{' || c == '}' || c == '(' || c == ')' || c == '=' || c == '<' || c == '>':
+			if strings.IndexByte("=<>", c) >= 0 && i+1 < len(q) && q[i+1] == '=' {
+				toks = append(toks, q[i:i+2])
+				i += 2
+				continue
+			}
+			toks = append(toks, string(c))
+			i++
+		case c == '!' && i+1 < len(q) && q[i+1] == '=':
+			toks = append(toks, "!=")
+			i += 2
+		default:
+			j := i
+			for j < len(q) && strings.IndexByte(" \t\n'{}()=!<>", q[j]) < 0 {
+				j++
+			}
+			toks = append(toks, q[i:j])
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+func isString(tok string) bool {
+	return strings.HasPrefix(tok, "'")
+}
+
+func parseTerm(toks []string) (predicate, []string, error) {
+	if len(toks) < 3 {
+		return nil, nil, fmt.Errorf("incomplete term %v", toks)
+	}
+
+	// 'value' in collection
+	if isString(toks[0]) && toks[1] == "in" {
+		v := toks[0][1:]
+		switch toks[2] {
+		case "owners":
+			return func(f *drive.File) bool { return isOwner(f, v) }, toks[3:], nil
+		case "parents":
+			return func(f *drive.File) bool {
+				for _, p := range f.Parents {
+					if p.Id == v {
+						return true
+					}
+				}
+				return false
+			}, toks[3:], nil
+		case "writers":
+			return func(f *drive.File) bool { return roleOf(f, v) >= roleWriter }, toks[3:], nil
+		case "readers":
+			return func(f *drive.File) bool { return roleOf(f, v) >= roleReader }, toks[3:], nil
+		}
+		return nil, nil, fmt.Errorf("unsupported collection %s", toks[2])
+	}
+
+	if toks[0] == "properties" && toks[1] == "has" {
+		return parseProperties(toks[2:])
+	}
+
+	field, op, value := toks[0], toks[1], toks[2]
+	if field == "trashed" {
+		want := value == "true"
+		return func(f *drive.File) bool {
+			return (f.Labels != nil && f.Labels.Trashed) == want
+		}, toks[3:], nil
+	}
+
+	if !isString(value) {
+		return nil, nil, fmt.Errorf("expected string, got %s", value)
+	}
+	value = value[1:]
+
+	var get func(f *drive.File) string
+	switch field {
+	case "title":
+		get = func(f *drive.File) string { return f.Title }
+	case "mimeType":
+		get = func(f *drive.File) string { return f.MimeType }
+	case "modifiedDate":
+		get = func(f *drive.File) string { return f.ModifiedDate }
+	default:
+		return nil, nil, fmt.Errorf("unsupported field %s", field)
+	}
+
+	switch op {
+	case "=":
+		return func(f *drive.File) bool { return get(f) == value }, toks[3:], nil
+	case "!=":
+		return func(f *drive.File) bool { return get(f) != value }, toks[3:], nil
+	case "contains":
+		return func(f *drive.File) bool { return strings.Contains(get(f), value) }, toks[3:], nil
+	case "<":
+		return func(f *drive.File) bool { return get(f) < value }, toks[3:], nil
+	case "<=":
+		return func(f *drive.File) bool { return get(f) <= value }, toks[3:], nil
+	case ">":
+		return func(f *drive.File) bool { return get(f) > value }, toks[3:], nil
+	case ">=":
+		return func(f *drive.File) bool { return get(f) >= value }, toks[3:], nil
+	}
+	return nil, nil, fmt.Errorf("unsupported operator %s", op)
+}
+
+// parseProperties parses "{ key='k' and value='v' and visibility='v' }".
+func parseProperties(toks []string) (predicate, []string, error) {
+	if len(toks) == 0 || toks[0] != "{" {
+		return nil, nil, fmt.Errorf("expected {")
+	}
+	toks = toks[1:]
+
+	want := map[string]string{}
+	for len(toks) >= 3 && toks[0] != "}" {
+		if toks[1] != "=" || !isString(toks[2]) {
+			return nil, nil, fmt.Errorf("invalid property condition %v", toks[:3])
+		}
+		want[toks[0]] = toks[2][1:]
+		toks = toks[3:]
+		if len(toks) > 0 && toks[0] == "and" {
+			toks = toks[1:]
+		}
+	}
+	if len(toks) == 0 || toks[0] != "}" {
+		return nil, nil, fmt.Errorf("expected }")
+	}
+
+	return func(f *drive.File) bool {
+		for _, p := range f.Properties {
+			if k, ok := want["key"]; ok && p.Key != k {
+				continue
+			}
+			if v, ok := want["value"]; ok && p.Value != v {
+				continue
+			}
+			if v, ok := want["visibility"]; ok && !strings.EqualFold(p.Visibility, v) {
+				continue
+			}
+			return true
+		}
+		return false
+	}, toks[1:], nil
+}
@@ -5,9 +5,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
-	"path/filepath"
+	"sync"
 
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
@@ -15,47 +14,51 @@ import (
 
 const (
 	FileClientSecret = "client_secret.json"
-	FileAuthSecret   = "auth_secret.json"
 
 	FolderMIME = "application/vnd.google-apps.folder"
 )
 
-// GetClient uses a Context and Config to retrieve a Token
-// then generate a Client. It returns the generated Client.
-func GetClient(ctx context.Context, config *oauth2.Config) *http.Client {
-	cacheFile := tokenCacheFile()
-	tok, err := tokenFromFile(cacheFile)
-	if err != nil {
-		tok = getTokenFromWeb(config)
-		saveToken(cacheFile, tok)
+// GetClient uses a Context and Config to retrieve a Token of the account
+// from the store, or from the web flow when there is none, then generate
+// a Client. Tokens refreshed by the Client are saved back to the store.
+func GetClient(ctx context.Context, config *oauth2.Config, store *TokenStore, account string, flow *WebFlow) (*http.Client, error) {
+	tok, err := store.Load(account)
+	if _, ok := err.(*NoTokenError); ok {
+		tok, err = getTokenFromWeb(ctx, config, account, flow)
+		if err != nil {
+			return nil, err
+		}
+		if err := saveToken(store, account, tok); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
 	}
-	return config.Client(ctx, tok)
-}
 
-// getTokenFromWeb uses Config to request a Token.
-// It returns the retrieved Token.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser then type the "+
-		"authorization code: \n%v\n", authURL)
-
-	var code string
-	if _, err := fmt.Scan(&code); err != nil {
-		log.Fatalf("Unable to read authorization code %v", err)
+	ts := &persistingTokenSource{
+		src:     config.TokenSource(ctx, tok),
+		store:   store,
+		account: account,
+		last:    tok,
 	}
-
-	tok, err := config.Exchange(oauth2.NoContext, code)
-	if err != nil {
-		log.Fatalf("Unable to retrieve token from web %v", err)
+	// Refresh an expired token now rather than on the first request
+	if _, err := ts.Token(); err != nil {
+		return nil, err
 	}
-	return tok
+	return oauth2.NewClient(ctx, ts), nil
 }
 
-// tokenCacheFile generates credential file path/filename.
-// It returns the generated credential path/filename.
-func tokenCacheFile() string {
-	return filepath.Join("./",
-		url.QueryEscape(FileAuthSecret))
+// getTokenFromWeb uses Config to request a Token for the account
+// through the browser. It returns the retrieved Token.
+func getTokenFromWeb(ctx context.Context, config *oauth2.Config, account string, flow *WebFlow) (*oauth2.Token, error) {
+	if flow == nil {
+		flow = &WebFlow{}
+	}
+	tok, err := flow.Token(ctx, config, account)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve token from web: %v", err)
+	}
+	return tok, nil
 }
 
 // tokenFromFile retrieves a Token from a given file path.
@@ -65,20 +68,46 @@ func tokenFromFile(file string) (*oauth2.Token, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 	t := &oauth2.Token{}
 	err = json.NewDecoder(f).Decode(t)
-	defer f.Close()
 	return t, err
 }
 
-// saveToken uses a file path to create a file and store the
-// token in it.
-func saveToken(file string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", file)
-	f, err := os.Create(file)
+// saveToken stores the token of the account.
+func saveToken(store *TokenStore, account string, token *oauth2.Token) error {
+	fmt.Printf("Saving credential file to: %s\n", store.path(account))
+	if err := store.Save(account, token); err != nil {
+		return fmt.Errorf("Unable to cache oauth token: %v", err)
+	}
+	return nil
+}
+
+// persistingTokenSource saves tokens refreshed by src to the store, so
+// a refreshed access token survives the process.
+type persistingTokenSource struct {
+	src     oauth2.TokenSource
+	store   *TokenStore
+	account string
+
+	mu   sync.Mutex
+	last *oauth2.Token
+}
+
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.src.Token()
 	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
+		return nil, &RefreshError{Account: s.account, Err: err}
 	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tok.AccessToken != s.last.AccessToken {
+		// A failed save only costs a refresh on the next run
+		if err := s.store.Save(s.account, tok); err != nil {
+			log.Printf("Unable to save refreshed oauth token: %v", err)
+		}
+		s.last = tok
+	}
+	return tok, nil
 }
@@ -0,0 +1,93 @@
+package gdrive
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// refreshServer issues "fresh" tokens for the refresh token "good".
+func refreshServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "good" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "fresh",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+}
+
+func tempStore(t *testing.T) (*TokenStore, func()) {
+	dir, err := ioutil.TempDir("", "gdrive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewTokenStore(dir), func() { os.RemoveAll(dir) }
+}
+
+func TestGetClientRefresh(t *testing.T) {
+	ts := refreshServer()
+	defer ts.Close()
+	store, done := tempStore(t)
+	defer done()
+	config := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: ts.URL}}
+
+	expired := &oauth2.Token{AccessToken: "stale", RefreshToken: "good", Expiry: time.Now().Add(-time.Hour)}
+	if err := store.Save("a@example.com", expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetClient(context.Background(), config, store, "a@example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := store.Load("a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "fresh" || tok.RefreshToken != "good" {
+		t.Errorf("stored token %+v, want refreshed access token and the same refresh token", tok)
+	}
+}
+
+func TestGetClientErrors(t *testing.T) {
+	ts := refreshServer()
+	defer ts.Close()
+	store, done := tempStore(t)
+	defer done()
+	config := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: ts.URL}}
+
+	revoked := &oauth2.Token{AccessToken: "stale", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Hour)}
+	if err := store.Save("revoked@example.com", revoked); err != nil {
+		t.Fatal(err)
+	}
+	_, err := GetClient(context.Background(), config, store, "revoked@example.com", nil)
+	if _, ok := err.(*RefreshError); !ok {
+		t.Errorf("revoked token: got %v, want RefreshError", err)
+	}
+
+	if err := ioutil.WriteFile(store.path("corrupt@example.com"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = GetClient(context.Background(), config, store, "corrupt@example.com", nil)
+	if _, ok := err.(*CorruptTokenError); !ok {
+		t.Errorf("corrupt token: got %v, want CorruptTokenError", err)
+	}
+
+	if _, err := store.Load("nobody@example.com"); err == nil {
+		t.Error("Load of a missing account succeeded")
+	} else if _, ok := err.(*NoTokenError); !ok {
+		t.Errorf("missing token: got %v, want NoTokenError", err)
+	}
+}
@@ -0,0 +1,235 @@
+package gdrive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// throughputWindow is the period Throughput averages over.
+	throughputWindow = 10 * time.Second
+
+	// minRate is the lowest rate Throttle goes down to.
+	minRate = 0.1
+)
+
+// bucket is a token bucket refilled at rate tokens per second.
+type bucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// wait returns how long until a token is available.
+func (b *bucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// RateLimiter throttles Drive requests to stay within the quotas. It
+// combines a queries per second limit with the per user limit Drive
+// counts over 100 seconds. When Drive answers userRateLimitExceeded
+// anyway, the rate is halved and then grows back slowly with every
+// successful request.
+//
+// One RateLimiter is meant to be shared by all services and workers
+// acting as the same user.
+type RateLimiter struct {
+	// Notify, if set, is called when the rate adapts.
+	Notify func(rate float64)
+
+	mu      sync.Mutex
+	max     float64 // configured requests per second
+	second  bucket
+	hundred bucket
+	done    []time.Time // completed requests within throughputWindow
+	start   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing qps requests per second and
+// perUser100s requests in 100 seconds. A limit of 0 is not enforced.
+func NewRateLimiter(qps float64, perUser100s int) *RateLimiter {
+	now := time.Now()
+	l := &RateLimiter{max: qps, start: now}
+	if qps > 0 {
+		l.second = bucket{rate: qps, capacity: qps, tokens: qps, last: now}
+		if l.second.capacity < 1 {
+			l.second.capacity = 1
+		}
+	}
+	if perUser100s > 0 {
+		n := float64(perUser100s)
+		l.hundred = bucket{rate: n / 100, capacity: n, tokens: n, last: now}
+	}
+	return l
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		var wait time.Duration
+		for _, b := range []*bucket{&l.second, &l.hundred} {
+			if b.rate == 0 {
+				continue
+			}
+			b.refill(now)
+			if w := b.wait(); w > wait {
+				wait = w
+			}
+		}
+		if wait == 0 {
+			for _, b := range []*bucket{&l.second, &l.hundred} {
+				if b.rate != 0 {
+					b.tokens--
+				}
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Throttle halves the current rate after Drive reported a rate limit.
+func (l *RateLimiter) Throttle() {
+	l.mu.Lock()
+	if l.second.rate == 0 {
+		// No per second limit, start from the recent throughput and
+		// let it grow back up to it
+		l.max = l.throughput(time.Now())
+		if l.max < 1 {
+			l.max = 1
+		}
+		l.second = bucket{rate: l.max, capacity: l.max, last: time.Now()}
+	}
+	l.second.rate /= 2
+	if l.second.rate < minRate {
+		l.second.rate = minRate
+	}
+	if l.second.tokens > 0 {
+		l.second.tokens = 0
+	}
+	rate := l.second.rate
+	l.mu.Unlock()
+
+	if l.Notify != nil {
+		l.Notify(rate)
+	}
+}
+
+// succeeded records a completed request and lets a throttled rate grow
+// back towards the configured one.
+func (l *RateLimiter) succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.throughput(now)
+	l.done = append(l.done, now)
+	if l.max > 0 && l.second.rate < l.max {
+		l.second.rate += l.max / 100
+		if l.second.rate > l.max {
+			l.second.rate = l.max
+		}
+	}
+}
+
+// Rate returns the current limit in requests per second, 0 if unlimited.
+func (l *RateLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.second.rate
+}
+
+// Throughput returns the completed requests per second over the last
+// 10 seconds, or since the limiter was created if that is shorter.
+func (l *RateLimiter) Throughput() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.throughput(time.Now())
+}
+
+func (l *RateLimiter) throughput(now time.Time) float64 {
+	i := 0
+	for i < len(l.done) && now.Sub(l.done[i]) > throughputWindow {
+		i++
+	}
+	l.done = l.done[i:]
+
+	window := throughputWindow
+	if d := now.Sub(l.start); d < window {
+		window = d
+	}
+	if window < time.Second {
+		window = time.Second
+	}
+	return float64(len(l.done)) / window.Seconds()
+}
+
+// rateLimitTransport waits for the limiter before every request.
+type rateLimitTransport struct {
+	limiter *RateLimiter
+	base    http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if rateLimited(resp) {
+		t.limiter.Throttle()
+	} else if resp.StatusCode < 300 {
+		t.limiter.succeeded()
+	}
+	return resp, nil
+}
+
+// rateLimited reports whether Drive refused the request because of
+// the request rate. The body is kept readable for the caller.
+func rateLimited(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+	default:
+		return false
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	return bytes.Contains(body, []byte(`"userRateLimitExceeded"`)) ||
+		bytes.Contains(body, []byte(`"rateLimitExceeded"`))
+}
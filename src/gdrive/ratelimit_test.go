@@ -0,0 +1,81 @@
+package gdrive
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	l := NewRateLimiter(100, 0)
+	start := time.Now()
+	// The first 100 requests use up the burst, the next 10 wait 10ms each
+	for i := 0; i < 110; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 80*time.Millisecond {
+		t.Errorf("110 requests at 100 qps took %s", d)
+	}
+
+	l = NewRateLimiter(0, 100)
+	for i := 0; i < 100; i++ {
+		l.Wait(context.Background())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Error("request over the 100 seconds quota not delayed")
+	}
+}
+
+func TestRateLimiterTransport(t *testing.T) {
+	limited := true
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limited {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":{"errors":[{"reason":"userRateLimitExceeded"}],"code":403}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"root"}`))
+	}))
+	defer api.Close()
+
+	l := NewRateLimiter(1000, 0)
+	client := &http.Client{Transport: &rateLimitTransport{limiter: l, base: http.DefaultTransport}}
+
+	r, err := client.Get(api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if !strings.Contains(string(body), "userRateLimitExceeded") {
+		t.Errorf("body not kept for the caller: %q", body)
+	}
+	if rate := l.Rate(); rate != 500 {
+		t.Errorf("rate %.1f after rate limit, want 500", rate)
+	}
+
+	limited = false
+	for i := 0; i < 10; i++ {
+		r, err := client.Get(api.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+	}
+	if rate := l.Rate(); rate != 600 {
+		t.Errorf("rate %.1f after 10 requests, want 600", rate)
+	}
+	if l.Throughput() == 0 {
+		t.Error("no throughput reported")
+	}
+}
@@ -0,0 +1,129 @@
+package gdrive
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+)
+
+// RetryPolicy retries Drive calls failing with transient errors using
+// exponential backoff with jitter.
+type RetryPolicy struct {
+	// InitialInterval is the wait before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between two attempts.
+	MaxInterval time.Duration
+	// Multiplier grows the interval after every attempt.
+	Multiplier float64
+	// MaxElapsedTime gives up retrying, 0 means never.
+	MaxElapsedTime time.Duration
+	// Notify, if set, is called before every wait.
+	Notify func(err error, wait time.Duration)
+}
+
+// DefaultRetryPolicy is used by Retry.
+var DefaultRetryPolicy = RetryPolicy{
+	InitialInterval: 500 * time.Millisecond,
+	MaxInterval:     time.Minute,
+	Multiplier:      2,
+	MaxElapsedTime:  10 * time.Minute,
+}
+
+// Reasons of 403 errors which go away when retried later.
+var retryableReasons = map[string]bool{
+	"rateLimitExceeded":        true,
+	"userRateLimitExceeded":    true,
+	"sharingRateLimitExceeded": true,
+	"backendError":             true,
+	"internalError":            true,
+}
+
+// Retryable reports whether a failed Drive call is worth retrying:
+// rate limits, backend and server errors and network failures.
+// Missing files, denied permissions and bad requests are not.
+func Retryable(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *googleapi.Error:
+		if e.Code == http.StatusTooManyRequests || e.Code >= 500 {
+			return true
+		}
+		for _, item := range e.Errors {
+			if retryableReasons[item.Reason] {
+				return true
+			}
+		}
+		return false
+	case *url.Error:
+		return Retryable(e.Err)
+	case net.Error:
+		return true
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// retryAfter returns the wait requested by the server, if any.
+func retryAfter(err error) time.Duration {
+	e, ok := err.(*googleapi.Error)
+	if !ok || e.Header == nil {
+		return 0
+	}
+	v := e.Header.Get("Retry-After")
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := time.Parse(time.RFC1123, v); err == nil {
+		return t.Sub(time.Now())
+	}
+	return 0
+}
+
+// Do calls fn until it succeeds, fails with an error which is not
+// Retryable, ctx is done or MaxElapsedTime passes. It returns the last
+// error of fn.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	start := time.Now()
+	interval := p.InitialInterval
+	for {
+		err := fn()
+		if !Retryable(err) {
+			return err
+		}
+
+		// Wait interval ± 50 %
+		wait := interval/2 + time.Duration(rand.Int63n(int64(interval)+1))
+		if ra := retryAfter(err); ra > wait {
+			wait = ra
+		}
+		if p.MaxElapsedTime > 0 && time.Since(start)+wait > p.MaxElapsedTime {
+			return err
+		}
+		if p.Notify != nil {
+			p.Notify(err, wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		interval = time.Duration(float64(interval) * p.Multiplier)
+		if interval > p.MaxInterval {
+			interval = p.MaxInterval
+		}
+	}
+}
+
+// Retry calls fn with DefaultRetryPolicy.
+func Retry(ctx context.Context, fn func() error) error {
+	return DefaultRetryPolicy.Do(ctx, fn)
+}
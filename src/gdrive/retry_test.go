@@ -0,0 +1,100 @@
+package gdrive
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+)
+
+var testPolicy = RetryPolicy{
+	InitialInterval: time.Millisecond,
+	MaxInterval:     10 * time.Millisecond,
+	Multiplier:      2,
+	MaxElapsedTime:  time.Second,
+}
+
+func apiError(code int, reason string) error {
+	e := &googleapi.Error{Code: code}
+	if reason != "" {
+		e.Errors = []googleapi.ErrorItem{{Reason: reason}}
+	}
+	return e
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{apiError(http.StatusNotFound, "notFound"), false},
+		{apiError(http.StatusForbidden, "insufficientFilePermissions"), false},
+		{apiError(http.StatusBadRequest, "invalid"), false},
+		{apiError(http.StatusForbidden, "userRateLimitExceeded"), true},
+		{apiError(http.StatusForbidden, "sharingRateLimitExceeded"), true},
+		{apiError(http.StatusTooManyRequests, ""), true},
+		{apiError(http.StatusServiceUnavailable, ""), true},
+		{&url.Error{Op: "Get", URL: "x", Err: apiError(http.StatusInternalServerError, "")}, true},
+	} {
+		if got := Retryable(tt.err); got != tt.want {
+			t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDo(t *testing.T) {
+	calls := 0
+	err := testPolicy.Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return apiError(http.StatusInternalServerError, "backendError")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("got %v after %d calls, want success after 3", err, calls)
+	}
+
+	calls = 0
+	notFound := apiError(http.StatusNotFound, "notFound")
+	if err := testPolicy.Do(context.Background(), func() error { calls++; return notFound }); err != notFound || calls != 1 {
+		t.Errorf("got %v after %d calls, want notFound after 1", err, calls)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	p := testPolicy
+	p.MaxElapsedTime = 50 * time.Millisecond
+	start := time.Now()
+	if err := p.Do(context.Background(), func() error { return apiError(http.StatusInternalServerError, "") }); err == nil {
+		t.Error("Do succeeded")
+	}
+	if d := time.Since(start); d > p.MaxElapsedTime {
+		t.Errorf("gave up after %s, want at most %s", d, p.MaxElapsedTime)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	p.MaxElapsedTime = 0
+	p.Do(ctx, func() error { calls++; return apiError(http.StatusInternalServerError, "") })
+	if calls != 1 {
+		t.Errorf("%d calls after cancel, want 1", calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	e := &googleapi.Error{Code: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {"2"}}}
+	if d := retryAfter(e); d != 2*time.Second {
+		t.Errorf("retryAfter = %s, want 2s", d)
+	}
+	if d := retryAfter(apiError(http.StatusServiceUnavailable, "")); d != 0 {
+		t.Errorf("retryAfter without header = %s, want 0", d)
+	}
+}
@@ -0,0 +1,211 @@
+package gdrive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v2"
+)
+
+// ErrNoCredentials is returned by NewService when neither a credential
+// source nor an HTTP client was given.
+var ErrNoCredentials = errors.New("gdrive: no credentials configured")
+
+// credentials returns an authorized client. The base client to wrap is
+// stored in ctx under oauth2.HTTPClient.
+type credentials func(ctx context.Context, o *serviceOptions) (*http.Client, error)
+
+type serviceOptions struct {
+	creds     credentials
+	flow      *WebFlow
+	scopes    []string
+	client    *http.Client
+	basePath  string
+	userAgent string
+	timeout   time.Duration
+	limiter   *RateLimiter
+}
+
+// Option configures NewService.
+type Option func(*serviceOptions)
+
+// WithClientSecret authorizes using an OAuth client secret file and
+// the token of the account kept in store. An empty account means the
+// only account in the store.
+func WithClientSecret(secretFile string, store *TokenStore, account string) Option {
+	return func(o *serviceOptions) {
+		o.creds = func(ctx context.Context, o *serviceOptions) (*http.Client, error) {
+			if account == "" {
+				var err error
+				if account, err = store.DefaultAccount(); err != nil {
+					return nil, err
+				}
+			}
+
+			b, err := ioutil.ReadFile(secretFile)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read client secret file: %v", err)
+			}
+
+			config, err := google.ConfigFromJSON(b, o.scopes...)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse client secret file to config: %v", err)
+			}
+			return GetClient(ctx, config, store, account, o.flow)
+		}
+	}
+}
+
+// WithServiceAccount authorizes as the service account of a JSON key
+// file. With a non-empty subject the service account impersonates that
+// user through domain-wide delegation.
+func WithServiceAccount(keyFile, subject string) Option {
+	return func(o *serviceOptions) {
+		o.creds = func(ctx context.Context, o *serviceOptions) (*http.Client, error) {
+			b, err := ioutil.ReadFile(keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read service account key file: %v", err)
+			}
+
+			config, err := google.JWTConfigFromJSON(b, o.scopes...)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse service account key file: %v", err)
+			}
+			if config.Email == "" || len(config.PrivateKey) == 0 {
+				return nil, fmt.Errorf("%s is not a service account key", keyFile)
+			}
+
+			// JWTConfigFromJSON ignores token_uri of the key
+			var key struct {
+				TokenURI string `json:"token_uri"`
+			}
+			if json.Unmarshal(b, &key) == nil && key.TokenURI != "" {
+				config.TokenURL = key.TokenURI
+			}
+
+			config.Subject = subject
+			return config.Client(ctx), nil
+		}
+	}
+}
+
+// WithTokenSource authorizes requests with tokens from ts.
+func WithTokenSource(ts oauth2.TokenSource) Option {
+	return func(o *serviceOptions) {
+		o.creds = func(ctx context.Context, o *serviceOptions) (*http.Client, error) {
+			return oauth2.NewClient(ctx, ts), nil
+		}
+	}
+}
+
+// WithWebFlow configures the browser flow used by WithClientSecret
+// to log in accounts without a stored token.
+func WithWebFlow(flow *WebFlow) Option {
+	return func(o *serviceOptions) {
+		o.flow = flow
+	}
+}
+
+// WithScopes overrides the default drive.DriveScope.
+func WithScopes(scopes ...string) Option {
+	return func(o *serviceOptions) {
+		o.scopes = scopes
+	}
+}
+
+// WithHTTPClient sets the client used for all requests. When no
+// credential source is given, the client is used as is.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *serviceOptions) {
+		o.client = client
+	}
+}
+
+// WithBasePath points the service to another Drive API endpoint,
+// e.g. a fake server. The URL must end with a slash.
+func WithBasePath(url string) Option {
+	return func(o *serviceOptions) {
+		o.basePath = url
+	}
+}
+
+// WithUserAgent appends ua to the User-Agent header.
+func WithUserAgent(ua string) Option {
+	return func(o *serviceOptions) {
+		o.userAgent = ua
+	}
+}
+
+// WithTimeout limits the time of every single request.
+func WithTimeout(d time.Duration) Option {
+	return func(o *serviceOptions) {
+		o.timeout = d
+	}
+}
+
+// WithRateLimiter sends every request through l. Share one limiter
+// between services acting as the same user.
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(o *serviceOptions) {
+		o.limiter = l
+	}
+}
+
+// NewService returns a Drive service configured by opts.
+func NewService(ctx context.Context, opts ...Option) (*drive.Service, error) {
+	o := &serviceOptions{scopes: []string{drive.DriveScope}}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var client *http.Client
+	switch {
+	case o.creds != nil:
+		base := o.client
+		if base == nil {
+			base = http.DefaultClient
+		}
+		var err error
+		client, err = o.creds(context.WithValue(ctx, oauth2.HTTPClient, base), o)
+		if err != nil {
+			return nil, err
+		}
+	case o.client != nil:
+		client = o.client
+	default:
+		return nil, ErrNoCredentials
+	}
+
+	if o.timeout > 0 {
+		c := *client
+		c.Timeout = o.timeout
+		client = &c
+	}
+	if o.limiter != nil {
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		c := *client
+		c.Transport = &rateLimitTransport{limiter: o.limiter, base: base}
+		client = &c
+	}
+
+	srv, err := drive.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve drive Client %v", err)
+	}
+	if o.basePath != "" {
+		srv.BasePath = o.basePath
+	}
+	srv.UserAgent = o.userAgent
+
+	return srv, nil
+}
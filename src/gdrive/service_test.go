@@ -0,0 +1,101 @@
+package gdrive
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestServiceAccount(t *testing.T) {
+	// Token endpoint issuing the impersonated user as access token
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if len(parts) != 3 {
+			http.Error(w, "bad assertion", http.StatusBadRequest)
+			return
+		}
+		b, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var claims struct {
+			Iss string `json:"iss"`
+			Sub string `json:"sub"`
+		}
+		json.Unmarshal(b, &claims)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": claims.Iss + ">" + claims.Sub,
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokens.Close()
+
+	var auth string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"id":"root"}`))
+	}))
+	defer api.Close()
+
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "robot@example.iam.gserviceaccount.com",
+		"private_key": string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(pk),
+		})),
+		"token_uri": tokens.URL,
+	})
+	f, err := ioutil.TempFile("", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(key)
+	f.Close()
+
+	srv, err := NewService(context.Background(),
+		WithServiceAccount(f.Name(), "user@example.com"),
+		WithBasePath(api.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.Files.Get("root").Do(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Bearer robot@example.iam.gserviceaccount.com>user@example.com"; auth != want {
+		t.Errorf("Authorization %q, want %q", auth, want)
+	}
+}
+
+func TestServiceAccountWrongKey(t *testing.T) {
+	f, err := ioutil.TempFile("", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"installed":{"client_id":"x"}}`)
+	f.Close()
+
+	if _, err := NewService(context.Background(), WithServiceAccount(f.Name(), "")); err == nil {
+		t.Error("NewService with a client secret as service account key succeeded")
+	}
+}
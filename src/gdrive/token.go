@@ -0,0 +1,170 @@
+package gdrive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+const tokenExt = ".json"
+
+// TokenStore keeps OAuth tokens of several accounts in a directory,
+// one file per account email.
+type TokenStore struct {
+	Dir string
+}
+
+// NewTokenStore returns a store in dir. An empty dir means
+// DefaultTokenDir.
+func NewTokenStore(dir string) *TokenStore {
+	if dir == "" {
+		dir = DefaultTokenDir()
+	}
+	return &TokenStore{Dir: dir}
+}
+
+// DefaultTokenDir returns $XDG_CONFIG_HOME/gdriver/tokens, falling back
+// to ~/.config/gdriver/tokens.
+func DefaultTokenDir() string {
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		config = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(config, "gdriver", "tokens")
+}
+
+// path generates credential path/filename of the account.
+func (s *TokenStore) path(account string) string {
+	return filepath.Join(s.Dir, url.QueryEscape(strings.ToLower(account))+tokenExt)
+}
+
+// NoTokenError is returned when no token is stored for the account.
+type NoTokenError struct {
+	Account string
+}
+
+func (e *NoTokenError) Error() string {
+	return fmt.Sprintf("No cached token for %s", e.Account)
+}
+
+// CorruptTokenError is returned when the stored token can't be read.
+type CorruptTokenError struct {
+	Account string
+	File    string
+	Err     error
+}
+
+func (e *CorruptTokenError) Error() string {
+	return fmt.Sprintf("Token file %s of %s is corrupt: %v", e.File, e.Account, e.Err)
+}
+
+// RefreshError is returned when the token expired and refreshing it
+// failed, e.g. because the access was revoked.
+type RefreshError struct {
+	Account string
+	Err     error
+}
+
+func (e *RefreshError) Error() string {
+	return fmt.Sprintf("Token of %s expired and refresh failed: %v", e.Account, e.Err)
+}
+
+// Load returns the stored token of the account.
+func (s *TokenStore) Load(account string) (*oauth2.Token, error) {
+	file := s.path(account)
+	tok, err := tokenFromFile(file)
+	if os.IsNotExist(err) {
+		return nil, &NoTokenError{Account: account}
+	}
+	if _, ok := err.(*os.PathError); ok {
+		return nil, err
+	}
+	if err != nil || tok.AccessToken == "" {
+		if err == nil {
+			err = fmt.Errorf("no access token")
+		}
+		return nil, &CorruptTokenError{Account: account, File: file, Err: err}
+	}
+	return tok, nil
+}
+
+// Save stores the token of the account. The file is readable by the
+// owner only and replaced atomically.
+func (s *TokenStore) Save(account string, token *oauth2.Token) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(s.Dir, ".token")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(token); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0600); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.path(account))
+}
+
+// Remove deletes the stored token of the account.
+func (s *TokenStore) Remove(account string) error {
+	return os.Remove(s.path(account))
+}
+
+// Accounts returns the sorted emails of all stored accounts.
+func (s *TokenStore) Accounts() ([]string, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []string
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, tokenExt) {
+			continue
+		}
+		account, err := url.QueryUnescape(strings.TrimSuffix(name, tokenExt))
+		if err != nil {
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return accounts, nil
+}
+
+// DefaultAccount returns the account to use when none was given,
+// which is the only stored one.
+func (s *TokenStore) DefaultAccount() (string, error) {
+	accounts, err := s.Accounts()
+	if err != nil {
+		return "", err
+	}
+	switch len(accounts) {
+	case 0:
+		return "", fmt.Errorf("No stored account in %s, pick one to log in", s.Dir)
+	case 1:
+		return accounts[0], nil
+	}
+	return "", fmt.Errorf("Several accounts stored (%s), pick one", strings.Join(accounts, ", "))
+}
@@ -0,0 +1,57 @@
+package gdrive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdrive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewTokenStore(filepath.Join(dir, "tokens"))
+	if _, err := s.DefaultAccount(); err == nil {
+		t.Error("DefaultAccount of an empty store succeeded")
+	}
+
+	for _, a := range []string{"b@example.com", "a@example.com"} {
+		if err := s.Save(a, &oauth2.Token{AccessToken: a}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tok, err := s.Load("a@example.com")
+	if err != nil || tok.AccessToken != "a@example.com" {
+		t.Fatalf("Load = %v, %v", tok, err)
+	}
+	fi, err := os.Stat(s.path("a@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("token file mode %o, want 600", perm)
+	}
+
+	accounts, err := s.Accounts()
+	if want := []string{"a@example.com", "b@example.com"}; err != nil || !reflect.DeepEqual(accounts, want) {
+		t.Errorf("Accounts = %v, %v, want %v", accounts, err, want)
+	}
+	if _, err := s.DefaultAccount(); err == nil {
+		t.Error("DefaultAccount with two accounts succeeded")
+	}
+
+	if err := s.Remove("b@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := s.DefaultAccount(); err != nil || a != "a@example.com" {
+		t.Errorf("DefaultAccount = %q, %v, want a@example.com", a, err)
+	}
+}
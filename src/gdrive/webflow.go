@@ -0,0 +1,246 @@
+package gdrive
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// WebFlow obtains a token in the browser. The authorization code is
+// delivered to a local listener on 127.0.0.1 (loopback redirect) and
+// protected by a random state and a PKCE challenge.
+type WebFlow struct {
+	// Headless prints the authorization URL instead of opening a
+	// browser. Over SSH the redirect to the local listener fails in the
+	// remote browser, so the user pastes the address it was redirected
+	// to from the browser's address bar. The flow waits for the paste
+	// even when the redirect reaches the listener.
+	Headless bool
+
+	// OpenBrowser opens the URL, nil uses the platform default.
+	OpenBrowser func(url string) error
+
+	// Input provides the pasted address in headless mode, default os.Stdin.
+	Input io.Reader
+
+	// Output receives instructions for the user, default os.Stdout.
+	Output io.Writer
+}
+
+// callback is the result of the authorization redirect.
+type callback struct {
+	code string
+	err  error
+}
+
+// Token runs the flow for the account and exchanges the code for a token.
+func (w *WebFlow) Token(ctx context.Context, config *oauth2.Config, account string) (*oauth2.Token, error) {
+	out := w.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to start local callback server: %v", err)
+	}
+	defer l.Close()
+
+	c := *config
+	c.RedirectURL = "http://" + l.Addr().String() + "/"
+
+	results := make(chan callback, 2)
+	srv := &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// Browsers also ask for /favicon.ico and the like
+		q := r.URL.Query()
+		if r.URL.Path != "/" || q.Get("code") == "" && q.Get("error") == "" {
+			http.NotFound(rw, r)
+			return
+		}
+		if w.Headless {
+			// Only the pasted address ends the flow, so the read of
+			// the input never outlives it
+			fmt.Fprintln(rw, "Paste the address of this page in the terminal.")
+			return
+		}
+		cb := parseCallback(q, state)
+		if cb.err != nil {
+			http.Error(rw, cb.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(rw, "Authorization complete, you may close this window.")
+		}
+		select {
+		case results <- cb:
+		default:
+		}
+	})}
+	go srv.Serve(l)
+
+	authURL := c.AuthCodeURL(state, oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("login_hint", account),
+		oauth2.SetAuthURLParam("code_challenge", challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+
+	if w.Headless {
+		fmt.Fprintf(out, "Go to the following link in your browser:\n%v\n\n"+
+			"Then paste the address of the page the browser was redirected to:\n", authURL)
+		go w.readPasted(state, results)
+	} else {
+		open := w.OpenBrowser
+		if open == nil {
+			open = openBrowser
+		}
+		if err := open(authURL); err != nil {
+			fmt.Fprintf(out, "Unable to open browser (%v), go to the following link:\n", err)
+		} else {
+			fmt.Fprintf(out, "Opening the following link in your browser:\n")
+		}
+		fmt.Fprintf(out, "%v\n", authURL)
+	}
+
+	var cb callback
+	select {
+	case cb = <-results:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if cb.err != nil {
+		return nil, cb.err
+	}
+
+	return exchange(ctx, &c, cb.code, verifier)
+}
+
+// readPasted reads the redirect address pasted by the user.
+func (w *WebFlow) readPasted(state string, results chan<- callback) {
+	in := w.Input
+	if in == nil {
+		in = os.Stdin
+	}
+	line, err := bufio.NewReader(in).ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" && err != nil {
+		results <- callback{err: fmt.Errorf("Unable to read redirect address: %v", err)}
+		return
+	}
+	u, err := url.Parse(line)
+	if err != nil {
+		results <- callback{err: fmt.Errorf("Invalid redirect address: %v", err)}
+		return
+	}
+	results <- parseCallback(u.Query(), state)
+}
+
+// parseCallback validates the state and extracts the code from the
+// redirect query.
+func parseCallback(q url.Values, state string) callback {
+	if e := q.Get("error"); e != "" {
+		return callback{err: fmt.Errorf("Authorization failed: %s", e)}
+	}
+	if q.Get("state") != state {
+		return callback{err: fmt.Errorf("Authorization failed: state mismatch")}
+	}
+	code := q.Get("code")
+	if code == "" {
+		return callback{err: fmt.Errorf("Authorization failed: no code")}
+	}
+	return callback{code: code}
+}
+
+// exchange trades the code for a token. It is Config.Exchange with
+// the PKCE verifier, which this version of oauth2 can't send.
+func exchange(ctx context.Context, config *oauth2.Config, code, verifier string) (*oauth2.Token, error) {
+	hc, ok := ctx.Value(oauth2.HTTPClient).(*http.Client)
+	if !ok {
+		hc = http.DefaultClient
+	}
+
+	r, err := hc.PostForm(config.Endpoint.TokenURL, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {config.RedirectURL},
+		"client_id":     {config.ClientID},
+		"client_secret": {config.ClientSecret},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve token from web %v", err)
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve token from web %v", err)
+	}
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, fmt.Errorf("Unable to retrieve token from web: %s\n%s", r.Status, body)
+	}
+
+	var res struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("Unable to retrieve token from web %v", err)
+	}
+	if res.AccessToken == "" {
+		return nil, fmt.Errorf("Unable to retrieve token from web: no access token")
+	}
+
+	tok := &oauth2.Token{
+		AccessToken:  res.AccessToken,
+		TokenType:    res.TokenType,
+		RefreshToken: res.RefreshToken,
+	}
+	if res.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
+
+// randomString returns 32 random bytes encoded for use in URLs.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	}
+	return exec.Command("xdg-open", url).Start()
+}
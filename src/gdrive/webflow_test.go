@@ -0,0 +1,195 @@
+package gdrive
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// fakeOAuth is an authorization server which approves every request
+// and checks the PKCE verifier on exchange.
+type fakeOAuth struct {
+	*httptest.Server
+	mu         sync.Mutex
+	challenges map[string]string // code -> challenge
+}
+
+func newFakeOAuth() *fakeOAuth {
+	o := &fakeOAuth{challenges: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("login_hint") != "a@example.com" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		o.mu.Lock()
+		o.challenges["code1"] = q.Get("code_challenge")
+		o.mu.Unlock()
+		v := url.Values{"code": {"code1"}, "state": {q.Get("state")}}
+		http.Redirect(w, r, q.Get("redirect_uri")+"?"+v.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		o.mu.Lock()
+		challenge := o.challenges[r.FormValue("code")]
+		o.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if challenge == "" || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	})
+	o.Server = httptest.NewServer(mux)
+	return o
+}
+
+func (o *fakeOAuth) config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Endpoint:     oauth2.Endpoint{AuthURL: o.URL + "/auth", TokenURL: o.URL + "/token"},
+	}
+}
+
+func TestWebFlowLoopback(t *testing.T) {
+	o := newFakeOAuth()
+	defer o.Close()
+
+	flow := &WebFlow{
+		// The browser follows the redirect to the local listener
+		OpenBrowser: func(u string) error {
+			go http.Get(u)
+			return nil
+		},
+		Output: ioutil.Discard,
+	}
+	tok, err := flow.Token(context.Background(), o.config(), "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "access" || tok.RefreshToken != "refresh" || tok.Expiry.IsZero() {
+		t.Errorf("unexpected token %+v", tok)
+	}
+}
+
+func TestWebFlowHeadless(t *testing.T) {
+	o := newFakeOAuth()
+	defer o.Close()
+
+	// The remote browser can't reach the listener, the user pastes
+	// the address it was redirected to.
+	in, paste := io.Pipe()
+	instructions, out := io.Pipe()
+	flow := &WebFlow{Headless: true, Input: in, Output: out}
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	pasted := make(chan error, 1)
+	go func() {
+		lines := bufio.NewReader(instructions)
+		lines.ReadString('\n')
+		authURL, _ := lines.ReadString('\n')
+		go io.Copy(ioutil.Discard, lines)
+		r, err := noRedirect.Get(strings.TrimSpace(authURL))
+		if err != nil {
+			paste.CloseWithError(err)
+			pasted <- err
+			return
+		}
+		r.Body.Close()
+		// A redirect reaching the listener doesn't end the flow
+		if r, err := http.Get(r.Header.Get("Location")); err == nil {
+			r.Body.Close()
+		}
+		_, err = io.WriteString(paste, r.Header.Get("Location")+"\n")
+		pasted <- err
+	}()
+
+	tok, err := flow.Token(context.Background(), o.config(), "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "access" {
+		t.Errorf("unexpected token %+v", tok)
+	}
+	select {
+	case err := <-pasted:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("the pasted address was not read")
+	}
+}
+
+func TestParseCallbackState(t *testing.T) {
+	cb := parseCallback(url.Values{"code": {"c"}, "state": {"forged"}}, "state")
+	if cb.err == nil {
+		t.Error("callback with wrong state accepted")
+	}
+	cb = parseCallback(url.Values{"error": {"access_denied"}, "state": {"state"}}, "state")
+	if cb.err == nil {
+		t.Error("denied callback accepted")
+	}
+}
+
+func TestWebFlowStrayRequests(t *testing.T) {
+	o := newFakeOAuth()
+	defer o.Close()
+
+	// The browser asks the listener for its icon and the bare address
+	// before it follows the redirect
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	flow := &WebFlow{
+		OpenBrowser: func(u string) error {
+			go func() {
+				r, err := noRedirect.Get(u)
+				if err != nil {
+					return
+				}
+				r.Body.Close()
+				callback, err := url.Parse(r.Header.Get("Location"))
+				if err != nil {
+					return
+				}
+				for _, u := range []string{"/favicon.ico", "/", callback.RequestURI()} {
+					if r, err := http.Get("http://" + callback.Host + u); err == nil {
+						r.Body.Close()
+					}
+				}
+			}()
+			return nil
+		},
+		Output: ioutil.Discard,
+	}
+	tok, err := flow.Token(context.Background(), o.config(), "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "access" {
+		t.Errorf("unexpected token %+v", tok)
+	}
+}